@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/howeyc/gopass"
+	log "github.com/sirupsen/logrus"
+	"github.com/walkert/stash/client"
+)
+
+// isConfirmation reports whether an askpass prompt is asking a yes/no
+// question, such as ssh's host key check, rather than for the password.
+func isConfirmation(prompt string) bool {
+	return os.Getenv("SSH_ASKPASS_PROMPT") == "confirm" || strings.Contains(prompt, "(yes/no")
+}
+
+// ttyPrompt asks for a password on the terminal at path, which defaults to
+// the controlling terminal. The terminal is still available when stdin and
+// stdout belong to ssh, sudo or gpg-agent.
+func ttyPrompt(path, prompt string, mask bool) ([]byte, error) {
+	if path == "" {
+		path = "/dev/tty"
+	}
+	tty, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return []byte{}, fmt.Errorf("unable to open terminal: %v", err)
+	}
+	defer tty.Close()
+	answer, err := gopass.GetPasswdPrompt(prompt, mask, tty, tty)
+	if err != nil {
+		return []byte{}, fmt.Errorf("unable to get password from user: %v", err)
+	}
+	return answer, nil
+}
+
+// askpassRetry is how long a process that was given a password has to ask
+// again for it to count as a retry.
+const askpassRetry = time.Minute
+
+// askpassEntryName returns the entry the answer to prompt is stashed in. ssh
+// and sudo name the user, host or key in their prompts so each one gets an
+// entry of its own. ssh-add's retry prompt shares the entry of its first.
+func askpassEntryName(prompt string) string {
+	if rest := strings.TrimPrefix(prompt, "Bad passphrase, try again for "); rest != prompt {
+		prompt = "Enter passphrase for " + rest
+	}
+	return "askpass:" + strings.TrimSpace(prompt)
+}
+
+// askpass implements the SSH_ASKPASS and SUDO_ASKPASS interface: the prompt
+// is given as an argument and the answer is written to out. The password
+// stashed for the prompt is used when set, otherwise the user is asked and
+// their answer is stashed. caller is the process asking, usually ssh or sudo.
+// The user is asked again, and the answer replaced, when the same process
+// asks twice since that means the last answer was wrong. store may be nil if
+// the server couldn't be reached.
+func askpass(ctx context.Context, store secretStore, prompt string, caller int, ask func(string, bool) ([]byte, error), out io.Writer) error {
+	if prompt == "" {
+		prompt = "Password: "
+	}
+	if isConfirmation(prompt) {
+		answer, err := ask(prompt, false)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(answer))
+		return nil
+	}
+	name := askpassEntryName(prompt)
+	// Records which process was last given an answer for the prompt
+	answered := name + "#caller"
+	retry := strings.Contains(strings.ToLower(prompt), "try again")
+	if store != nil && !retry {
+		last, err := store.Get(ctx, answered)
+		retry = err == nil && last == strconv.Itoa(caller)
+	}
+	var password []byte
+	if store != nil && !retry {
+		stashed, err := store.Get(ctx, name)
+		if err == nil {
+			password = []byte(stashed)
+		} else if client.ErrorKind(err) != client.KindNotSet {
+			log.Debugf("Unable to get stashed password: %v\n", err)
+		}
+	}
+	if len(password) == 0 {
+		var err error
+		password, err = ask(prompt, true)
+		if err != nil {
+			return err
+		}
+		if store != nil && len(password) > 0 {
+			if err := store.Set(ctx, name, password); err != nil {
+				log.Debugf("Unable to stash password: %v\n", err)
+			}
+		}
+	}
+	fmt.Fprintln(out, string(password))
+	if store != nil {
+		if err := store.Set(ctx, answered, []byte(strconv.Itoa(caller)), client.TTL(askpassRetry)); err != nil {
+			log.Debugf("Unable to record the caller: %v\n", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestAskpass(t *testing.T) {
+	ctx := context.Background()
+	asked := 0
+	answer := "typed"
+	ask := func(prompt string, mask bool) ([]byte, error) {
+		asked++
+		if !mask {
+			return []byte("yes"), nil
+		}
+		return []byte(answer), nil
+	}
+	store := fakeStore{}
+	var out bytes.Buffer
+	prompt := "alice@example.com's password: "
+	if err := askpass(ctx, store, prompt, 100, ask, &out); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if out.String() != "typed\n" || asked != 1 {
+		t.Fatalf("expected user to be asked, got: %q after %d prompts\n", out.String(), asked)
+	}
+	if store[askpassEntryName(prompt)] != "typed" {
+		t.Fatalf("expected answer to be stashed, got: %v\n", store)
+	}
+	out.Reset()
+	if err := askpass(ctx, store, prompt, 101, ask, &out); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if out.String() != "typed\n" || asked != 1 {
+		t.Fatalf("expected stashed password, got: %q after %d prompts\n", out.String(), asked)
+	}
+	// The same process asking again was given the wrong password
+	out.Reset()
+	answer = "corrected"
+	if err := askpass(ctx, store, prompt, 101, ask, &out); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if out.String() != "corrected\n" || asked != 2 {
+		t.Fatalf("expected user to be asked again, got: %q after %d prompts\n", out.String(), asked)
+	}
+	if store[askpassEntryName(prompt)] != "corrected" {
+		t.Fatalf("expected answer to be replaced, got: %v\n", store)
+	}
+	// Other hosts and keys have passwords of their own
+	out.Reset()
+	answer = "other"
+	if err := askpass(ctx, store, "bob@example.com's password: ", 102, ask, &out); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if out.String() != "other\n" || asked != 3 {
+		t.Fatalf("expected user to be asked for another host, got: %q after %d prompts\n", out.String(), asked)
+	}
+	// ssh-add's retry prompt replaces the passphrase for the key
+	out.Reset()
+	store[askpassEntryName("Enter passphrase for /k: ")] = "wrong"
+	answer = "right"
+	if err := askpass(ctx, store, "Bad passphrase, try again for /k: ", 103, ask, &out); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if out.String() != "right\n" || store[askpassEntryName("Enter passphrase for /k: ")] != "right" {
+		t.Fatalf("expected the passphrase to be asked for again, got: %q (%v)\n", out.String(), store)
+	}
+	out.Reset()
+	confirm := "Are you sure you want to continue connecting (yes/no/[fingerprint])? "
+	if err := askpass(ctx, store, confirm, 104, ask, &out); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if out.String() != "yes\n" {
+		t.Fatalf("expected confirmation to be asked, got: %q\n", out.String())
+	}
+	out.Reset()
+	if err := askpass(ctx, nil, prompt, 105, ask, &out); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if out.String() != "right\n" {
+		t.Fatalf("expected user to be asked without a server, got: %q\n", out.String())
+	}
+	failing := func(string, bool) ([]byte, error) {
+		return []byte{}, fmt.Errorf("no terminal")
+	}
+	if err := askpass(ctx, fakeStore{}, prompt, 106, failing, &out); err == nil {
+		t.Fatalf("expected error but got none")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// startBackground re-runs this binary in its own session with args, which
+// start with one of its hidden flags, and hands it state as JSON. The state
+// is written to a pipe rather than passed as an argument so that secrets in
+// it don't show up in the process list. what names the process in errors.
+func startBackground(what string, state interface{}, args ...string) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	binary, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return fmt.Errorf("unable to find %s: %v", os.Args[0], err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	cmd := exec.Command(binary, args...)
+	cmd.Stdin = r
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		w.Close()
+		return fmt.Errorf("unable to start %s: %v", what, err)
+	}
+	w.Write(data)
+	w.Close()
+	return cmd.Process.Release()
+}
+
+// readBackgroundState reads the state handed to a process started by
+// startBackground.
+func readBackgroundState(what string, state interface{}) error {
+	if err := json.NewDecoder(os.Stdin).Decode(state); err != nil {
+		return fmt.Errorf("unable to read %s state: %v", what, err)
+	}
+	return nil
+}
@@ -1,43 +1,71 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"crypto/aes"
+	gocipher "crypto/cipher"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
-	"github.com/howeyc/gopass"
+	"github.com/mitchellh/go-homedir"
 	"github.com/walkert/cipher"
+	evp "github.com/walkert/go-evp"
 	pb "github.com/walkert/stash/stashproto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
 )
 
-var TestPass []byte
-
 type Client struct {
-	c      pb.StashClient
-	config string
+	c        pb.StashClient
+	conn     *grpc.ClientConn
+	config   string
+	health   healthpb.HealthClient
+	policies []Policy
+	source   PasswordSource
 }
 
 func (c *Client) readConfig() (string, error) {
 	data, err := ioutil.ReadFile(c.config)
 	if err != nil {
-		return "", fmt.Errorf("unable to read %s: %v\n", c.config, err)
+		wrapped := fmt.Errorf("unable to read %s: %v\n", c.config, err)
+		// Without a config file this client has never set a password
+		if os.IsNotExist(err) {
+			return "", &Error{Kind: KindNotSet, Err: wrapped}
+		}
+		return "", wrapped
+	}
+	// Nor with an empty one
+	if len(data) == 0 {
+		return "", &Error{Kind: KindNotSet, Err: fmt.Errorf("%s is empty\n", c.config)}
 	}
 	return string(data), nil
 }
 
+// writeConfig replaces the config file, making sure only its owner can read
+// it since it holds the keys to every entry.
 func (c *Client) writeConfig(data string) error {
-	file, err := os.Create(c.config)
+	file, err := os.OpenFile(c.config, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return fmt.Errorf("unable to create %s: %v\n", c.config, err)
 	}
 	defer file.Close()
-	file.WriteString(data)
+	// OpenFile leaves the mode of an existing file alone
+	if err := file.Chmod(0600); err != nil {
+		return fmt.Errorf("unable to restrict %s: %v\n", c.config, err)
+	}
+	if _, err := file.WriteString(data); err != nil {
+		return fmt.Errorf("unable to write %s: %v\n", c.config, err)
+	}
 	return nil
 }
 
@@ -47,6 +75,9 @@ func (c *Client) authDetails() (auth, salt, encPass string, err error) {
 		return "", "", "", err
 	}
 	spl := strings.Split(string(data), ":")
+	if len(spl) != 2 || len(spl[1]) < 16 {
+		return "", "", "", fmt.Errorf("invalid config in %s\n", c.config)
+	}
 	auth = spl[0]
 	saltPass := spl[1]
 	salt = saltPass[:len(saltPass)/2][:8]
@@ -54,95 +85,654 @@ func (c *Client) authDetails() (auth, salt, encPass string, err error) {
 	return auth, salt, encPass, nil
 }
 
-func (c *Client) getMetaContext() (context.Context, error) {
+func (c *Client) getMetaContext(ctx context.Context) (context.Context, error) {
 	auth, _, _, err := c.authDetails()
 	if err != nil {
-		return context.Background(), err
+		return ctx, err
 	}
 	auth = base64.StdEncoding.EncodeToString([]byte(auth))
 	md := metadata.Pairs("auth", auth)
-	return metadata.NewOutgoingContext(context.Background(), md), nil
+	return metadata.NewOutgoingContext(ctx, md), nil
 }
 
-func (c *Client) readPasswordFromUser() ([]byte, error) {
-	var (
-		err  error
-		pass []byte
-	)
-	if len(TestPass) != 0 {
-		pass = TestPass
-	} else {
-		fmt.Printf("Password: ")
-		pass, err = gopass.GetPasswdMasked()
-		if err != nil {
-			return []byte{}, fmt.Errorf("unable to get password from user: %v", err)
-		}
+// keys returns the auth token and encryption keys from the config file. New
+// ones are created and saved if the client has never set a password or the
+// server no longer holds anything set with the current ones, so that an old
+// copy of the config can't decrypt entries stored later.
+func (c *Client) keys(ctx context.Context) (auth, salt, encPass string, err error) {
+	auth, salt, encPass, err = c.authDetails()
+	if err == nil && !c.unused(ctx) {
+		return auth, salt, encPass, nil
+	}
+	// A config that can't be read or parsed is left for the user to fix
+	if err != nil && ErrorKind(err) != KindNotSet {
+		return "", "", "", err
 	}
-	auth := cipher.RandomString(10)
+	auth = cipher.RandomString(10)
 	random := cipher.RandomString(30)
-	salt := random[:len(random)/2][:8]
-	encPass := random[len(random)/2:]
-	data, err := cipher.EncryptString(string(pass), salt, encPass)
+	salt = random[:len(random)/2][:8]
+	encPass = random[len(random)/2:]
+	err = c.writeConfig(fmt.Sprintf("%s:%s", auth, random))
 	if err != nil {
-		return []byte{}, fmt.Errorf("unable to encrypt password: %v", err)
+		return "", "", "", err
 	}
-	err = c.writeConfig(fmt.Sprintf("%s:%s", auth, random))
+	return auth, salt, encPass, nil
+}
+
+// unused reports whether the server holds no entries set with the client's
+// current auth token, including when another client has taken it over.
+func (c *Client) unused(ctx context.Context) bool {
+	names, err := c.List(ctx)
 	if err != nil {
-		return []byte{}, err
+		return ErrorKind(err) == KindAuth
 	}
-	return data, nil
+	return len(names) == 0
 }
 
-func (c *Client) GetPassword() (string, error) {
-	ctx, err := c.getMetaContext()
+// PasswordField is the name under which an entry's password appears
+// alongside its other fields.
+const PasswordField = "password"
+
+// GetFields returns the decrypted password and fields of the entry called
+// name. The password is returned as PasswordField if the entry has one.
+func (c *Client) GetFields(ctx context.Context, name string) (map[string]string, error) {
+	ctx, err := c.getMetaContext(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	result, err := c.c.Get(ctx, &pb.Void{})
+	result, err := c.c.Get(ctx, &pb.Entry{Name: name})
 	if err != nil {
-		return "", fmt.Errorf("unable to get password: %v\n", err)
+		return nil, rpcError(err, fmt.Errorf("unable to get password: %v\n", err))
 	}
 	_, salt, encPass, err := c.authDetails()
+	if err != nil {
+		return nil, err
+	}
+	encrypted := map[string][]byte{}
+	for _, f := range result.GetFields() {
+		encrypted[f.GetName()] = f.GetValue()
+	}
+	if len(result.GetPassword()) > 0 {
+		encrypted[PasswordField] = result.GetPassword()
+	}
+	fields := map[string]string{}
+	for field, data := range encrypted {
+		value, err := cipher.DecryptBytes(data, salt, encPass)
+		if err != nil {
+			return nil, &Error{Kind: KindDecrypt, Err: fmt.Errorf("error decrypting %s: %v\n", field, err)}
+		}
+		fields[field] = string(value)
+	}
+	return fields, nil
+}
+
+// GetField returns the decrypted value of one field of the entry called
+// name.
+func (c *Client) GetField(ctx context.Context, name, field string) (string, error) {
+	fields, err := c.GetFields(ctx, name)
 	if err != nil {
 		return "", err
 	}
-	password, err := cipher.DecryptBytes(result.GetPassword(), salt, encPass)
+	value, ok := fields[field]
+	if !ok {
+		return "", &Error{Kind: KindNotSet, Err: fmt.Errorf("%s has no %s field", entryName(name), field)}
+	}
+	return value, nil
+}
+
+// Get returns the decrypted password of the entry called name.
+func (c *Client) Get(ctx context.Context, name string) (string, error) {
+	return c.GetField(ctx, name, PasswordField)
+}
+
+func entryName(name string) string {
+	if name == "" {
+		return "the default entry"
+	}
+	return name
+}
+
+// SetOption configures an entry stored by Set.
+type SetOption func(*pb.Payload)
+
+// TTL makes the server drop the entry after d, or sooner if the server's own
+// expiration comes first. The server counts in seconds so d is rounded up,
+// which stops a TTL under a second from meaning no TTL at all.
+func TTL(d time.Duration) SetOption {
+	return func(p *pb.Payload) {
+		p.Ttl = int64((d + time.Second - 1) / time.Second)
+	}
+}
+
+// MaxReads makes the server drop the entry after it has been fetched n
+// times. MaxReads(1) is useful for handing a secret over exactly once.
+func MaxReads(n int) SetOption {
+	return func(p *pb.Payload) {
+		p.MaxReads = int64(n)
+	}
+}
+
+// ExpireAt makes the server drop the entry at t, or sooner if its TTL or the
+// server's own expiration comes first.
+func ExpireAt(t time.Time) SetOption {
+	return func(p *pb.Payload) {
+		p.ExpiresAt = t.Unix()
+	}
+}
+
+// BindPID makes the server drop the entry once the process pid exits. The
+// server and the process must be on the same host.
+func BindPID(pid int) SetOption {
+	return func(p *pb.Payload) {
+		p.BindPid = int64(pid)
+	}
+}
+
+// Set encrypts value and stores it as the password of the entry called
+// name, replacing any existing value. The client's policies are checked
+// first.
+func (c *Client) Set(ctx context.Context, name string, value []byte, opts ...SetOption) error {
+	return c.SetFields(ctx, name, map[string][]byte{PasswordField: value}, opts...)
+}
+
+// SetFields encrypts each of fields and stores them in the entry called
+// name, replacing any existing value. The client's policies are checked
+// against PasswordField if it's one of the fields.
+func (c *Client) SetFields(ctx context.Context, name string, fields map[string][]byte, opts ...SetOption) error {
+	payload, err := c.newPayload(ctx, name, fields, opts)
+	if err != nil {
+		return err
+	}
+	ctx, err = c.getMetaContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = c.c.Set(ctx, payload)
+	if err != nil {
+		return rpcError(err, fmt.Errorf("unable to set password: %v", err))
+	}
+	return nil
+}
+
+// newPayload checks the client's policies and encrypts fields into a payload
+// for the entry called name.
+func (c *Client) newPayload(ctx context.Context, name string, fields map[string][]byte, opts []SetOption) (*pb.Payload, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields to set")
+	}
+	if value, ok := fields[PasswordField]; ok {
+		if err := checkPolicies(value, c.policies); err != nil {
+			return nil, err
+		}
+	}
+	_, salt, encPass, err := c.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	payload := &pb.Payload{Name: name}
+	var names []string
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+	for _, field := range names {
+		data, err := cipher.EncryptBytes(fields[field], salt, encPass)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encrypt %s: %v", field, err)
+		}
+		if field == PasswordField {
+			payload.Password = data
+			continue
+		}
+		payload.Fields = append(payload.Fields, &pb.Field{Name: field, Value: data})
+	}
+	for _, opt := range opts {
+		opt(payload)
+	}
+	return payload, nil
+}
+
+// Hold encrypts value and stores it as the password of the entry called name
+// for only as long as ctx is live. It returns once the entry is stored. The
+// returned channel receives nil once ctx is done, which ends the stream and
+// has the server drop the entry, or an error if the server drops it first.
+func (c *Client) Hold(ctx context.Context, name string, value []byte, opts ...SetOption) (<-chan error, error) {
+	payload, err := c.newPayload(ctx, name, map[string][]byte{PasswordField: value}, opts)
+	if err != nil {
+		return nil, err
+	}
+	metaCtx, err := c.getMetaContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := c.c.Hold(metaCtx, payload)
+	if err != nil {
+		return nil, rpcError(err, fmt.Errorf("unable to hold password: %v", err))
+	}
+	// The server sends a message once the entry has been stored
+	if _, err := stream.Recv(); err != nil {
+		return nil, rpcError(err, fmt.Errorf("unable to hold password: %v", err))
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := stream.Recv()
+		switch {
+		case ctx.Err() != nil:
+			done <- nil
+		case err == io.EOF:
+			done <- &Error{Kind: KindNotSet, Err: fmt.Errorf("%s is no longer held", entryName(name))}
+		default:
+			done <- rpcError(err, fmt.Errorf("lost hold on %s: %v", entryName(name), err))
+		}
+	}()
+	return done, nil
+}
+
+// chunkSize is the amount of data sent in each message of an Upload.
+const chunkSize = 64 * 1024
+
+// newEncrypter returns a CBC encrypter that produces the same output as
+// cipher.EncryptBytes so that data can be encrypted as it's read while still
+// being readable by Get and Download.
+func newEncrypter(salt, encPass string) (gocipher.BlockMode, error) {
+	key, iv := evp.BytesToKey256([]byte(salt), []byte(encPass), 32, aes.BlockSize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return gocipher.NewCBCEncrypter(block, iv), nil
+}
+
+// pad applies PKCS5 padding to the final piece of data. A full block of
+// padding is added when data is already aligned.
+func pad(data []byte, size int) []byte {
+	n := size - len(data)%size
+	return append(data, bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+// Upload encrypts everything read from r and stores it as the password of
+// the entry called name. Unlike Set the data is read, encrypted and sent to
+// the server in chunks so it isn't limited by the size of a single message
+// or held in memory, which suits files such as private keys. The client's
+// policies aren't checked.
+func (c *Client) Upload(ctx context.Context, name string, r io.Reader, opts ...SetOption) error {
+	buf := make([]byte, chunkSize)
+	n, rerr := io.ReadFull(r, buf)
+	if n == 0 && rerr == io.EOF {
+		return &Error{Kind: KindPolicy, Err: fmt.Errorf("refusing to store empty data")}
+	}
+	_, salt, encPass, err := c.keys(ctx)
+	if err != nil {
+		return err
+	}
+	mode, err := newEncrypter(salt, encPass)
+	if err != nil {
+		return fmt.Errorf("unable to encrypt data: %v", err)
+	}
+	ctx, err = c.getMetaContext(ctx)
+	if err != nil {
+		return err
+	}
+	// The stream is cancelled if reading fails so that the server doesn't
+	// store partial data
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// The name and options are sent with the first chunk
+	payload := &pb.Payload{}
+	for _, opt := range opts {
+		opt(payload)
+	}
+	stream, err := c.c.Upload(ctx)
+	if err != nil {
+		return rpcError(err, fmt.Errorf("unable to upload data: %v", err))
+	}
+	chunk := &pb.Chunk{
+		Name:      name,
+		Ttl:       payload.GetTtl(),
+		MaxReads:  payload.GetMaxReads(),
+		BindPid:   payload.GetBindPid(),
+		ExpiresAt: payload.GetExpiresAt(),
+	}
+	for {
+		last := rerr == io.EOF || rerr == io.ErrUnexpectedEOF
+		if rerr != nil && !last {
+			return fmt.Errorf("unable to read data: %v", rerr)
+		}
+		data := buf[:n]
+		if last {
+			data = pad(data, mode.BlockSize())
+		}
+		mode.CryptBlocks(data, data)
+		chunk.Data = data
+		if err := stream.Send(chunk); err != nil {
+			// The server's reason for ending the stream comes from
+			// CloseAndRecv
+			break
+		}
+		if last {
+			break
+		}
+		chunk = &pb.Chunk{}
+		n, rerr = io.ReadFull(r, buf)
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		return rpcError(err, fmt.Errorf("unable to upload data: %v", err))
+	}
+	return nil
+}
+
+// Download decrypts the password of the entry called name and writes it to
+// w. It's the counterpart of Upload.
+func (c *Client) Download(ctx context.Context, name string, w io.Writer) error {
+	ctx, err := c.getMetaContext(ctx)
+	if err != nil {
+		return err
+	}
+	stream, err := c.c.Download(ctx, &pb.Entry{Name: name})
+	if err != nil {
+		return rpcError(err, fmt.Errorf("unable to download data: %v", err))
+	}
+	var data []byte
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rpcError(err, fmt.Errorf("unable to download data: %v", err))
+		}
+		data = append(data, chunk.GetData()...)
+	}
+	_, salt, encPass, err := c.authDetails()
+	if err != nil {
+		return err
+	}
+	value, err := cipher.DecryptBytes(data, salt, encPass)
+	if err != nil {
+		return &Error{Kind: KindDecrypt, Err: fmt.Errorf("error decrypting data: %v\n", err)}
+	}
+	if _, err := w.Write(value); err != nil {
+		return fmt.Errorf("unable to write data: %v", err)
+	}
+	return nil
+}
+
+// Mount writes field of the entry called name to a new file at path, which
+// only its owner can read. The server removes the file when the entry
+// expires, is replaced or deleted, or the server stops. path should be on
+// a tmpfs so the secret never reaches the disk. Entries limited by MaxReads
+// are refused, since reading one could drop it and its file
+// before the file was any use.
+func (c *Client) Mount(ctx context.Context, name, field, path string) error {
+	st, err := c.Status(ctx, name)
+	if err != nil {
+		return err
+	}
+	if st.ReadsLeft > 0 {
+		return fmt.Errorf("%s is limited to %d more reads so it can't be mounted", name, st.ReadsLeft)
+	}
+	value, err := c.GetField(ctx, name, field)
+	if err != nil {
+		return err
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("unable to create %s: %v", filepath.Dir(path), err)
+	}
+	// The file is only handed to the server once it holds the secret so
+	// the server never removes something it wasn't meant to
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %v", path, err)
+	}
+	_, err = file.WriteString(value)
+	file.Close()
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("unable to write %s: %v", path, err)
+	}
+	mctx, err := c.getMetaContext(ctx)
+	if err == nil {
+		_, err = c.c.Mount(mctx, &pb.Mount{Name: name, Path: path})
+		if err != nil {
+			err = rpcError(err, fmt.Errorf("unable to mount %s: %v", path, err))
+		}
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// Delete removes the entry called name.
+func (c *Client) Delete(ctx context.Context, name string) error {
+	ctx, err := c.getMetaContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = c.c.Delete(ctx, &pb.Entry{Name: name})
+	if err != nil {
+		return rpcError(err, fmt.Errorf("unable to delete password: %v\n", err))
+	}
+	return nil
+}
+
+// List returns the names of all entries.
+func (c *Client) List(ctx context.Context) ([]string, error) {
+	ctx, err := c.getMetaContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.c.List(ctx, &pb.Void{})
+	if err != nil {
+		return nil, rpcError(err, fmt.Errorf("unable to list entries: %v\n", err))
+	}
+	var names []string
+	for _, e := range result.GetEntries() {
+		names = append(names, e.GetName())
+	}
+	return names, nil
+}
+
+// GetPassword returns the default entry.
+func (c *Client) GetPassword(ctx context.Context) (string, error) {
+	return c.Get(ctx, "")
+}
+
+// SetPassword reads a password from the client's PasswordSource and stores
+// it in the default entry.
+func (c *Client) SetPassword(ctx context.Context, opts ...SetOption) error {
+	return c.SetFromSource(ctx, "", opts...)
+}
+
+// SetFromSource reads a password from the client's PasswordSource and stores
+// it in the entry called name.
+func (c *Client) SetFromSource(ctx context.Context, name string, opts ...SetOption) error {
+	pass, err := c.source()
 	if err != nil {
-		return "", fmt.Errorf("error decrypting password: %v\n", err)
+		return err
 	}
-	return string(password), nil
+	return c.Set(ctx, name, pass, opts...)
 }
 
-func (c *Client) SetPassword() error {
-	data, err := c.readPasswordFromUser()
+// SetPIN sets the PIN the server's entries are locked with. Once it's set
+// the server may lock itself when it's idle.
+func (c *Client) SetPIN(ctx context.Context, pin []byte) error {
+	ctx, err := c.getMetaContext(ctx)
 	if err != nil {
 		return err
 	}
-	ctx, err := c.getMetaContext()
+	if _, err := c.c.SetPin(ctx, &pb.Pin{Pin: pin}); err != nil {
+		return rpcError(err, fmt.Errorf("unable to set PIN: %v", err))
+	}
+	return nil
+}
+
+// Lock locks the server so that nothing can be fetched from it until it's
+// unlocked with its PIN. The PIN is replaced by pin unless it's empty.
+func (c *Client) Lock(ctx context.Context, pin []byte) error {
+	ctx, err := c.getMetaContext(ctx)
 	if err != nil {
 		return err
 	}
-	_, err = c.c.Set(ctx, &pb.Payload{Password: data})
+	if _, err := c.c.Lock(ctx, &pb.Pin{Pin: pin}); err != nil {
+		return rpcError(err, fmt.Errorf("unable to lock: %v", err))
+	}
+	return nil
+}
+
+// Unlock unlocks the server with its PIN.
+func (c *Client) Unlock(ctx context.Context, pin []byte) error {
+	ctx, err := c.getMetaContext(ctx)
 	if err != nil {
-		return fmt.Errorf("unable to set password: %v", err)
+		return err
+	}
+	if _, err := c.c.Unlock(ctx, &pb.Pin{Pin: pin}); err != nil {
+		return rpcError(err, fmt.Errorf("unable to unlock: %v", err))
 	}
 	return nil
 }
 
-func New(port int, configFile, certFile string) (*Client, error) {
-	var opt grpc.DialOption
-	if certFile != "" {
-		creds, err := credentials.NewClientTLSFromFile(certFile, "")
+// Status describes whether a password is stored on the server and when it
+// will expire. Expires is the zero time if the password never expires and
+// ReadsLeft is 0 if it may be fetched any number of times.
+type Status struct {
+	Set       bool
+	Expires   time.Time
+	ReadsLeft int
+	Locked    bool
+}
+
+// Status reports whether the entry called name is set and when it expires.
+func (c *Client) Status(ctx context.Context, name string) (Status, error) {
+	ctx, err := c.getMetaContext(ctx)
+	if err != nil {
+		// Without a config this client hasn't set anything
+		if ErrorKind(err) == KindNotSet {
+			return Status{}, nil
+		}
+		return Status{}, err
+	}
+	result, err := c.c.Status(ctx, &pb.Entry{Name: name})
+	if err != nil {
+		return Status{}, rpcError(err, fmt.Errorf("unable to get status: %v\n", err))
+	}
+	status := Status{Set: result.GetSet(), ReadsLeft: int(result.GetReadsLeft()), Locked: result.GetLocked()}
+	if result.GetExpires() != 0 {
+		status.Expires = time.Unix(result.GetExpires(), 0)
+	}
+	return status, nil
+}
+
+// Option configures a Client created by New.
+type Option func(*options)
+
+type options struct {
+	certFile string
+	config   string
+	policies []Policy
+	source   PasswordSource
+	timeout  time.Duration
+}
+
+// WithConfig sets the file used to store the client's auth token and keys.
+// It defaults to ~/.stash.
+func WithConfig(path string) Option {
+	return func(o *options) {
+		o.config = path
+	}
+}
+
+// WithPasswordSource sets where SetPassword reads the password from. It
+// defaults to prompting the user on the terminal.
+func WithPasswordSource(source PasswordSource) Option {
+	return func(o *options) {
+		o.source = source
+	}
+}
+
+// WithPolicy adds policies that SetPassword checks before sending the
+// password to the server.
+func WithPolicy(policies ...Policy) Option {
+	return func(o *options) {
+		o.policies = append(o.policies, policies...)
+	}
+}
+
+// WithTLS enables TLS using the server certificate in certFile.
+func WithTLS(certFile string) Option {
+	return func(o *options) {
+		o.certFile = certFile
+	}
+}
+
+// WithTimeout makes New block for up to d while connecting to the server.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+func New(addr string, opts ...Option) (*Client, error) {
+	o := &options{source: PromptSource()}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.config == "" {
+		dir, err := homedir.Dir()
+		if err != nil {
+			return &Client{}, fmt.Errorf("unable to find home directory: %v", err)
+		}
+		o.config = filepath.Join(dir, ".stash")
+	}
+	var dialOpts []grpc.DialOption
+	if o.certFile != "" {
+		creds, err := credentials.NewClientTLSFromFile(o.certFile, "")
 		if err != nil {
 			return &Client{}, fmt.Errorf("unable to set tls: %v", err)
 		}
-		opt = grpc.WithTransportCredentials(creds)
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(creds))
 	} else {
-		opt = grpc.WithInsecure()
+		dialOpts = append(dialOpts, grpc.WithInsecure())
+	}
+	ctx := context.Background()
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+		dialOpts = append(dialOpts, grpc.WithBlock())
+	}
+	conn, err := grpc.DialContext(ctx, addr, dialOpts...)
+	if err != nil {
+		return &Client{}, &Error{Kind: KindUnreachable, Err: fmt.Errorf("could not connect to server: %v\n", err)}
 	}
-	conn, err := grpc.Dial(fmt.Sprintf("localhost:%d", port), opt)
+	return &Client{
+		c:        pb.NewStashClient(conn),
+		conn:     conn,
+		config:   o.config,
+		health:   healthpb.NewHealthClient(conn),
+		policies: o.policies,
+		source:   o.source,
+	}, nil
+}
+
+// Healthy returns an error if the server is not serving requests.
+func (c *Client) Healthy(ctx context.Context) error {
+	resp, err := c.health.Check(ctx, &healthpb.HealthCheckRequest{})
 	if err != nil {
-		return &Client{}, fmt.Errorf("coult not connect to server: %v\n", err)
+		return rpcError(err, fmt.Errorf("health check failed: %v", err))
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return &Error{Kind: KindUnreachable, Err: fmt.Errorf("server is %s", resp.GetStatus())}
 	}
-	return &Client{c: pb.NewStashClient(conn), config: configFile}, nil
+	return nil
+}
+
+// Close closes the connection to the server.
+func (c *Client) Close() error {
+	return c.conn.Close()
 }
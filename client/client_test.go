@@ -1,13 +1,18 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/walkert/cipher"
 	"github.com/walkert/stash/server"
+	pb "github.com/walkert/stash/stashproto"
 )
 
 func TestSetGet(t *testing.T) {
@@ -18,7 +23,7 @@ func TestSetGet(t *testing.T) {
 	go func() {
 		err := s.Start()
 		if err != nil {
-			t.Fatalf("problem starting server: %v", err)
+			t.Errorf("problem starting server: %v", err)
 		}
 	}()
 	defer s.Stop()
@@ -27,16 +32,19 @@ func TestSetGet(t *testing.T) {
 		t.Fatalf("unable to create temp file: %s\n", err)
 	}
 	defer os.Remove(file.Name())
-	c, err := New(5001, file.Name(), "")
+	c, err := New(
+		"localhost:5001",
+		WithConfig(file.Name()),
+		WithPasswordSource(ReaderSource(strings.NewReader("test"))),
+	)
 	if err != nil {
 		t.Fatalf("unexpected error while getting client: %v\n", err)
 	}
-	TestPass = []byte("test")
-	err = c.SetPassword()
+	err = c.SetPassword(context.Background())
 	if err != nil {
 		t.Fatalf("unexpected error while setting password: %v\n", err)
 	}
-	pass, err := c.GetPassword()
+	pass, err := c.GetPassword(context.Background())
 	if err != nil {
 		t.Fatalf("unexpected error while getting password: %v\n", err)
 	}
@@ -52,11 +60,328 @@ func TestSetGet(t *testing.T) {
 	}
 	file.WriteString(fmt.Sprintf("%s:badSaltandpasswordstring", spl[0]))
 	file.Close()
-	_, err = c.GetPassword()
+	_, err = c.GetPassword(context.Background())
 	if err == nil {
 		t.Fatalf("expected error but got none")
 	}
 	if !strings.Contains(err.Error(), "data could not be decrypted") {
 		t.Fatalf("Unexpected error string: %s\n", err.Error())
 	}
+	if ErrorKind(err) != KindDecrypt {
+		t.Fatalf("Wanted error kind %d, got: %d\n", KindDecrypt, ErrorKind(err))
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	s, err := server.New("localhost", 5001, "", "", 0)
+	if err != nil {
+		t.Fatalf("problem starting server: %v", err)
+	}
+	go func() {
+		err := s.Start()
+		if err != nil {
+			t.Errorf("problem starting server: %v", err)
+		}
+	}()
+	defer s.Stop()
+	c, err := New("localhost:5001", WithTimeout(time.Second*5))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	if err := c.Healthy(context.Background()); err != nil {
+		t.Fatalf("unexpected error from health check: %v\n", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("unexpected error while closing client: %v\n", err)
+	}
+	if err := c.Healthy(context.Background()); err == nil {
+		t.Fatalf("expected error from health check on closed client but got none")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	_, err := New("localhost:5009", WithTimeout(time.Millisecond*100))
+	if err == nil {
+		t.Fatalf("expected error connecting to missing server but got none")
+	}
+	if ErrorKind(err) != KindUnreachable {
+		t.Fatalf("Wanted error kind %d, got: %d\n", KindUnreachable, ErrorKind(err))
+	}
+}
+
+func TestPasswordSources(t *testing.T) {
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("from-file\n")
+	file.Close()
+	os.Setenv("STASH_TEST_PASSWORD", "from-env")
+	defer os.Unsetenv("STASH_TEST_PASSWORD")
+	tests := []struct {
+		source PasswordSource
+		want   string
+	}{
+		{ReaderSource(strings.NewReader("from-reader\r\n")), "from-reader"},
+		{FileSource(file.Name()), "from-file"},
+		{EnvSource("STASH_TEST_PASSWORD"), "from-env"},
+	}
+	for _, test := range tests {
+		got, err := test.source()
+		if err != nil {
+			t.Fatalf("unexpected error reading password: %v\n", err)
+		}
+		if string(got) != test.want {
+			t.Fatalf("Wanted: '%s', got: %s\n", test.want, got)
+		}
+	}
+	_, err = EnvSource("STASH_TEST_MISSING")()
+	if err == nil {
+		t.Fatalf("expected error reading missing variable but got none")
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	tests := []struct {
+		password string
+		policies []Policy
+		ok       bool
+	}{
+		{"", nil, false},
+		{"short", []Policy{MinLength(8)}, false},
+		{"longenough", []Policy{MinLength(8)}, true},
+		{"lowercase", []Policy{RequireClasses(Lower, Digit)}, false},
+		{"lower4case", []Policy{RequireClasses(Lower, Digit)}, true},
+		{"aaaa", []Policy{MinStrength(40)}, false},
+		{"Tr0ub4dor&3xyz", []Policy{MinStrength(40)}, true},
+	}
+	for _, test := range tests {
+		err := checkPolicies([]byte(test.password), test.policies)
+		if test.ok && err != nil {
+			t.Fatalf("unexpected error checking '%s': %v\n", test.password, err)
+		}
+		if !test.ok {
+			if err == nil {
+				t.Fatalf("expected error checking '%s' but got none", test.password)
+			}
+			if ErrorKind(err) != KindPolicy {
+				t.Fatalf("Wanted error kind %d, got: %d\n", KindPolicy, ErrorKind(err))
+			}
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		pass, err := Generate(GenerateOptions{Length: 12, Classes: []Class{Lower, Digit}, ExcludeAmbiguous: true})
+		if err != nil {
+			t.Fatalf("unexpected error generating password: %v\n", err)
+		}
+		if len(pass) != 12 {
+			t.Fatalf("Wanted 12 characters, got: %s\n", pass)
+		}
+		if err := RequireClasses(Lower, Digit)([]byte(pass)); err != nil {
+			t.Fatalf("generated password %s is missing a class: %v\n", pass, err)
+		}
+		if strings.ContainsAny(pass, "ABC!1lo0") {
+			t.Fatalf("generated password %s contains excluded characters\n", pass)
+		}
+	}
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("apple\nbanana\ncherry\nno\nDamson\n")
+	file.Close()
+	phrase, err := Generate(GenerateOptions{Words: 4, WordList: file.Name(), Separator: "-"})
+	if err != nil {
+		t.Fatalf("unexpected error generating passphrase: %v\n", err)
+	}
+	words := strings.Split(phrase, "-")
+	if len(words) != 4 {
+		t.Fatalf("Wanted 4 words, got: %s\n", phrase)
+	}
+	for _, word := range words {
+		if word != "apple" && word != "banana" && word != "cherry" {
+			t.Fatalf("unexpected word in passphrase: %s\n", phrase)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	s, err := server.New("localhost", 5001, "", "", 0)
+	if err != nil {
+		t.Fatalf("problem starting server: %v", err)
+	}
+	go func() {
+		err := s.Start()
+		if err != nil {
+			t.Errorf("problem starting server: %v", err)
+		}
+	}()
+	defer s.Stop()
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(file.Name())
+	c, err := New("localhost:5001", WithConfig(file.Name()))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	ctx := context.Background()
+	fields := map[string][]byte{"username": []byte("alice"), PasswordField: []byte("secret")}
+	if err := c.SetFields(ctx, "site", fields); err != nil {
+		t.Fatalf("unexpected error while setting fields: %v\n", err)
+	}
+	got, err := c.GetFields(ctx, "site")
+	if err != nil {
+		t.Fatalf("unexpected error while getting fields: %v\n", err)
+	}
+	if len(got) != 2 || got["username"] != "alice" || got[PasswordField] != "secret" {
+		t.Fatalf("Wanted username and password fields, got: %v\n", got)
+	}
+	pass, err := c.Get(ctx, "site")
+	if err != nil || pass != "secret" {
+		t.Fatalf("Wanted: 'secret', got: %s (%v)\n", pass, err)
+	}
+	if err := c.SetFields(ctx, "user", map[string][]byte{"username": []byte("bob")}); err != nil {
+		t.Fatalf("unexpected error while setting fields: %v\n", err)
+	}
+	_, err = c.Get(ctx, "user")
+	if ErrorKind(err) != KindNotSet {
+		t.Fatalf("Wanted error kind %d for a missing password, got: %v\n", KindNotSet, err)
+	}
+}
+
+func TestEncrypter(t *testing.T) {
+	for _, size := range []int{1, 15, 16, chunkSize - 1, chunkSize, chunkSize*2 + 7} {
+		data := []byte(strings.Repeat("x", size))
+		want, err := cipher.EncryptBytes(data, "salt", "password")
+		if err != nil {
+			t.Fatalf("unexpected error encrypting: %v\n", err)
+		}
+		mode, err := newEncrypter("salt", "password")
+		if err != nil {
+			t.Fatalf("unexpected error getting encrypter: %v\n", err)
+		}
+		// Encrypt the data a chunk at a time as Upload does
+		var got []byte
+		for rest := data; ; rest = rest[chunkSize:] {
+			if len(rest) < chunkSize {
+				piece := pad(append([]byte{}, rest...), mode.BlockSize())
+				mode.CryptBlocks(piece, piece)
+				got = append(got, piece...)
+				break
+			}
+			piece := append([]byte{}, rest[:chunkSize]...)
+			mode.CryptBlocks(piece, piece)
+			got = append(got, piece...)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%d bytes: chunked encryption doesn't match cipher.EncryptBytes\n", size)
+		}
+	}
+}
+
+func TestTTL(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want int64
+	}{
+		{0, 0},
+		{time.Millisecond * 500, 1},
+		{time.Second, 1},
+		{time.Millisecond * 1500, 2},
+		{time.Hour, 3600},
+	}
+	for _, tt := range tests {
+		p := &pb.Payload{}
+		TTL(tt.d)(p)
+		if p.GetTtl() != tt.want {
+			t.Fatalf("%s: Wanted a TTL of %d, got: %d\n", tt.d, tt.want, p.GetTtl())
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	s, err := server.New("localhost", 5001, "", "", 0)
+	if err != nil {
+		t.Fatalf("problem starting server: %v", err)
+	}
+	go func() {
+		err := s.Start()
+		if err != nil {
+			t.Errorf("problem starting server: %v", err)
+		}
+	}()
+	defer s.Stop()
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	config := dir + "/config"
+	c, err := New("localhost:5001", WithConfig(config))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	ctx := context.Background()
+	if err := c.Set(ctx, "a", []byte("value")); err != nil {
+		t.Fatalf("unexpected error while setting: %v\n", err)
+	}
+	info, err := os.Stat(config)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Wanted the config to be private, got: %v (%v)\n", info, err)
+	}
+	first, _ := ioutil.ReadFile(config)
+	// The keys are kept while the server holds entries set with them
+	if err := c.Set(ctx, "b", []byte("value")); err != nil {
+		t.Fatalf("unexpected error while setting: %v\n", err)
+	}
+	if current, _ := ioutil.ReadFile(config); string(current) != string(first) {
+		t.Fatalf("expected the keys to be kept while entries exist\n")
+	}
+	c.Delete(ctx, "a")
+	c.Delete(ctx, "b")
+	if err := c.Set(ctx, "c", []byte("value")); err != nil {
+		t.Fatalf("unexpected error while setting: %v\n", err)
+	}
+	if current, _ := ioutil.ReadFile(config); string(current) == string(first) {
+		t.Fatalf("expected new keys once the server held no entries\n")
+	}
+	if value, err := c.Get(ctx, "c"); err != nil || value != "value" {
+		t.Fatalf("Wanted: 'value', got: %s (%v)\n", value, err)
+	}
+	// A broken config is left alone
+	ioutil.WriteFile(config, []byte("broken"), 0600)
+	if err := c.Set(ctx, "d", []byte("value")); err == nil {
+		t.Fatalf("expected an error setting with a broken config but got none")
+	}
+	if current, _ := ioutil.ReadFile(config); string(current) != "broken" {
+		t.Fatalf("expected the broken config to be left alone, got: %s\n", current)
+	}
+}
+
+func TestStatusConfig(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	config := dir + "/config"
+	// The server is never contacted without a usable config
+	c, err := New("localhost:1", WithConfig(config))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	if st, err := c.Status(context.Background(), ""); err != nil || st.Set {
+		t.Fatalf("Wanted an unset status without a config, got: %+v (%v)\n", st, err)
+	}
+	ioutil.WriteFile(config, []byte("broken"), 0600)
+	if _, err := c.Status(context.Background(), ""); err == nil {
+		t.Fatalf("expected an error with a broken config but got none")
+	}
 }
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Kind describes the category of failure behind an Error.
+type Kind int
+
+const (
+	// KindOther covers any failure not described by a more specific Kind.
+	KindOther Kind = iota
+	// KindNotSet means the server has no password stored.
+	KindNotSet
+	// KindAuth means the server rejected the client's auth token.
+	KindAuth
+	// KindUnreachable means the server could not be contacted.
+	KindUnreachable
+	// KindDecrypt means the password could not be decrypted locally.
+	KindDecrypt
+	// KindPolicy means the password was rejected by a Policy.
+	KindPolicy
+	// KindLocked means the server is locked and must be unlocked with its
+	// PIN first.
+	KindLocked
+)
+
+// Error is returned by the client when an operation fails.
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// ErrorKind returns the Kind of err or KindOther if err was not returned by
+// the client.
+func ErrorKind(err error) Kind {
+	if e, ok := err.(*Error); ok {
+		return e.Kind
+	}
+	return KindOther
+}
+
+// rpcError wraps err, which was returned by an RPC, in an Error whose Kind
+// reflects the gRPC status code.
+func rpcError(err, wrapped error) *Error {
+	kind := KindOther
+	switch status.Code(err) {
+	case codes.NotFound:
+		kind = KindNotSet
+	case codes.Unauthenticated:
+		kind = KindAuth
+	case codes.Unavailable, codes.DeadlineExceeded:
+		kind = KindUnreachable
+	case codes.FailedPrecondition:
+		kind = KindLocked
+	}
+	return &Error{Kind: kind, Err: wrapped}
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// DefaultWordList is the word list used for passphrases when none is given.
+const DefaultWordList = "/usr/share/dict/words"
+
+// ambiguous are characters which are easily confused with one another.
+const ambiguous = "Il1O0o|`'\""
+
+var classChars = map[Class]string{
+	Lower:  "abcdefghijklmnopqrstuvwxyz",
+	Upper:  "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	Digit:  "0123456789",
+	Symbol: "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~",
+}
+
+// GenerateOptions controls the passwords returned by Generate.
+type GenerateOptions struct {
+	// Length is the number of characters in a generated password.
+	Length int
+	// Classes are the character classes to draw from. Every class is used
+	// at least once when Length allows it. All classes are used if empty.
+	Classes []Class
+	// ExcludeAmbiguous removes characters such as 'l', '1' and 'O'. It has
+	// no effect on passphrases.
+	ExcludeAmbiguous bool
+	// Words generates a passphrase of this many words instead of a password.
+	Words int
+	// WordList is a file containing one word per line. DefaultWordList is
+	// used if empty.
+	WordList string
+	// Separator is placed between the words of a passphrase.
+	Separator string
+}
+
+// randomInt returns a uniformly distributed random number in [0, n) read
+// from a cryptographic source.
+func randomInt(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("unable to read random data: %v", err)
+	}
+	return int(i.Int64()), nil
+}
+
+// Generate returns a random password or passphrase.
+func Generate(opts GenerateOptions) (string, error) {
+	if opts.Words > 0 {
+		return generatePassphrase(opts)
+	}
+	if opts.Length <= 0 {
+		return "", fmt.Errorf("password length must be positive")
+	}
+	classes := opts.Classes
+	if len(classes) == 0 {
+		classes = []Class{Lower, Upper, Digit, Symbol}
+	}
+	var charset []rune
+	for _, class := range classes {
+		for _, r := range classChars[class] {
+			if opts.ExcludeAmbiguous && strings.ContainsRune(ambiguous, r) {
+				continue
+			}
+			charset = append(charset, r)
+		}
+	}
+	for {
+		password := make([]rune, opts.Length)
+		for i := range password {
+			n, err := randomInt(len(charset))
+			if err != nil {
+				return "", err
+			}
+			password[i] = charset[n]
+		}
+		// Draw again rather than patching in characters so that every
+		// position stays uniformly distributed
+		if opts.Length < len(classes) || RequireClasses(classes...)([]byte(string(password))) == nil {
+			return string(password), nil
+		}
+	}
+}
+
+func generatePassphrase(opts GenerateOptions) (string, error) {
+	path := opts.WordList
+	if path == "" {
+		path = DefaultWordList
+	}
+	words, err := readWords(path)
+	if err != nil {
+		return "", err
+	}
+	if len(words) < 2 {
+		return "", fmt.Errorf("word list %s doesn't contain enough words", path)
+	}
+	phrase := make([]string, opts.Words)
+	for i := range phrase {
+		n, err := randomInt(len(words))
+		if err != nil {
+			return "", err
+		}
+		phrase[i] = words[n]
+	}
+	return strings.Join(phrase, opts.Separator), nil
+}
+
+// readWords returns the distinct lower case words of three to eight letters
+// found in path.
+func readWords(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read word list: %v", err)
+	}
+	defer file.Close()
+	seen := map[string]bool{}
+	var words []string
+	scanner := bufio.NewScanner(file)
+outer:
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if len(word) < 3 || len(word) > 8 || seen[word] {
+			continue
+		}
+		for _, r := range word {
+			if r < 'a' || r > 'z' {
+				continue outer
+			}
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read word list: %v", err)
+	}
+	return words, nil
+}
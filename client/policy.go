@@ -0,0 +1,137 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Policy checks a password before it is sent to the server and returns an
+// error describing why it is unacceptable.
+type Policy func(password []byte) error
+
+// Class is a class of characters that a password can be required to contain.
+type Class int
+
+const (
+	Lower Class = iota
+	Upper
+	Digit
+	Symbol
+)
+
+var classNames = map[Class]string{
+	Lower:  "lower",
+	Upper:  "upper",
+	Digit:  "digit",
+	Symbol: "symbol",
+}
+
+func (c Class) String() string {
+	return classNames[c]
+}
+
+// ParseClass returns the Class called name.
+func ParseClass(name string) (Class, error) {
+	for class, n := range classNames {
+		if n == name {
+			return class, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown character class %q", name)
+}
+
+func classOf(r rune) Class {
+	switch {
+	case unicode.IsLower(r):
+		return Lower
+	case unicode.IsUpper(r):
+		return Upper
+	case unicode.IsDigit(r):
+		return Digit
+	}
+	return Symbol
+}
+
+// classSizes is the number of printable ASCII characters in each class, used
+// when estimating strength.
+var classSizes = map[Class]int{
+	Lower:  26,
+	Upper:  26,
+	Digit:  10,
+	Symbol: 33,
+}
+
+// MinLength rejects passwords shorter than n characters.
+func MinLength(n int) Policy {
+	return func(password []byte) error {
+		if l := len([]rune(string(password))); l < n {
+			return fmt.Errorf("password must be at least %d characters long, got %d", n, l)
+		}
+		return nil
+	}
+}
+
+// RequireClasses rejects passwords that don't contain at least one character
+// from each of classes.
+func RequireClasses(classes ...Class) Policy {
+	return func(password []byte) error {
+		found := map[Class]bool{}
+		for _, r := range string(password) {
+			found[classOf(r)] = true
+		}
+		var missing []string
+		for _, class := range classes {
+			if !found[class] {
+				missing = append(missing, class.String())
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("password must contain %s characters", strings.Join(missing, ", "))
+		}
+		return nil
+	}
+}
+
+// Strength estimates the entropy of password in bits assuming each character
+// was chosen at random from the classes it uses.
+func Strength(password []byte) float64 {
+	runes := []rune(string(password))
+	found := map[Class]bool{}
+	for _, r := range runes {
+		found[classOf(r)] = true
+	}
+	size := 0
+	for class := range found {
+		size += classSizes[class]
+	}
+	if size == 0 {
+		return 0
+	}
+	return float64(len(runes)) * math.Log2(float64(size))
+}
+
+// MinStrength rejects passwords whose Strength is below bits.
+func MinStrength(bits float64) Policy {
+	return func(password []byte) error {
+		if strength := Strength(password); strength < bits {
+			return fmt.Errorf("password is too weak: estimated %.0f bits, need %.0f", strength, bits)
+		}
+		return nil
+	}
+}
+
+// checkPolicies returns the first error reported by policies. Empty
+// passwords are always rejected.
+func checkPolicies(password []byte, policies []Policy) error {
+	if len(password) == 0 {
+		return &Error{Kind: KindPolicy, Err: fmt.Errorf("password must not be empty")}
+	}
+	for _, policy := range policies {
+		if err := policy(password); err != nil {
+			return &Error{Kind: KindPolicy, Err: err}
+		}
+	}
+	return nil
+}
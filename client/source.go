@@ -0,0 +1,95 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/howeyc/gopass"
+)
+
+// PasswordSource supplies the password stored by SetPassword.
+type PasswordSource func() ([]byte, error)
+
+// PromptSource asks the user for the password on the terminal, echoing a
+// mask character for each key press.
+func PromptSource() PasswordSource {
+	return func() ([]byte, error) {
+		fmt.Printf("Password: ")
+		pass, err := gopass.GetPasswdMasked()
+		if err != nil {
+			return []byte{}, fmt.Errorf("unable to get password from user: %v", err)
+		}
+		return pass, nil
+	}
+}
+
+// ConfirmPromptSource is like PromptSource but asks for the password twice
+// and returns an error if the two don't match.
+func ConfirmPromptSource() PasswordSource {
+	prompt := PromptSource()
+	return func() ([]byte, error) {
+		pass, err := prompt()
+		if err != nil {
+			return []byte{}, err
+		}
+		fmt.Printf("Confirm password: ")
+		confirm, err := gopass.GetPasswdMasked()
+		if err != nil {
+			return []byte{}, fmt.Errorf("unable to get password from user: %v", err)
+		}
+		if !bytes.Equal(pass, confirm) {
+			return []byte{}, fmt.Errorf("passwords do not match")
+		}
+		return pass, nil
+	}
+}
+
+// ValueSource returns password as is. It is useful when the password has
+// been produced by the caller, for example by Generate.
+func ValueSource(password []byte) PasswordSource {
+	return func() ([]byte, error) {
+		return password, nil
+	}
+}
+
+// ReaderSource reads the password from r. A single trailing newline is
+// removed so that the output of commands like echo can be used directly.
+func ReaderSource(r io.Reader) PasswordSource {
+	return func() ([]byte, error) {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return []byte{}, fmt.Errorf("unable to read password: %v", err)
+		}
+		return trimNewline(data), nil
+	}
+}
+
+// FileSource reads the password from the file at path.
+func FileSource(path string) PasswordSource {
+	return func() ([]byte, error) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return []byte{}, fmt.Errorf("unable to read password from %s: %v", path, err)
+		}
+		return trimNewline(data), nil
+	}
+}
+
+// EnvSource reads the password from the environment variable name.
+func EnvSource(name string) PasswordSource {
+	return func() ([]byte, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return []byte{}, fmt.Errorf("environment variable %s is not set", name)
+		}
+		return []byte(value), nil
+	}
+}
+
+func trimNewline(data []byte) []byte {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	return bytes.TrimSuffix(data, []byte("\r"))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+
+	"github.com/walkert/stash/clipboard"
+)
+
+// clipState is passed to the background process that restores the clipboard.
+type clipState struct {
+	Command  string `json:"command"`
+	Secret   []byte `json:"secret"`
+	Previous []byte `json:"previous"`
+	Timeout  int    `json:"timeout"`
+}
+
+func clipboardCommand(name string) (clipboard.Command, error) {
+	if name == "" {
+		return clipboard.Detect()
+	}
+	return clipboard.Named(name)
+}
+
+// copyToClipboard copies secret to the clipboard and starts a background
+// process which restores the previous contents after timeout seconds.
+func copyToClipboard(secret, command string, timeout int) error {
+	cb, err := clipboardCommand(command)
+	if err != nil {
+		return err
+	}
+	previous, err := clipboard.Copy(cb, []byte(secret))
+	if err != nil {
+		return err
+	}
+	if timeout <= 0 {
+		return nil
+	}
+	state := clipState{Command: command, Secret: []byte(secret), Previous: previous, Timeout: timeout}
+	return startBackground("clipboard restore", state, "--restore-clipboard")
+}
+
+// restoreClipboard runs in the background process started by copyToClipboard.
+func restoreClipboard() error {
+	var state clipState
+	if err := readBackgroundState("clipboard", &state); err != nil {
+		return err
+	}
+	cb, err := clipboardCommand(state.Command)
+	if err != nil {
+		return err
+	}
+	return clipboard.Restore(cb, state.Secret, state.Previous, time.Second*time.Duration(state.Timeout))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/walkert/stash/clipboard"
+)
+
+// fakeClipboardEnv names the file the fake clipboard command keeps its
+// contents in. It's passed through the environment so that the restore
+// process, which is this test binary re-run, uses the same file.
+const fakeClipboardEnv = "STASH_TEST_CLIPBOARD"
+
+func TestMain(m *testing.M) {
+	clipboard.Commands = append(clipboard.Commands, struct {
+		Name    string
+		Command clipboard.Command
+	}{"fake", clipboard.Command{
+		Copy:  []string{"sh", "-c", `cat > "$` + fakeClipboardEnv + `"`},
+		Paste: []string{"sh", "-c", `cat "$` + fakeClipboardEnv + `" 2>/dev/null || true`},
+	}})
+	// copyToClipboard starts os.Args[0] with --restore-clipboard
+	if len(os.Args) > 1 && os.Args[1] == "--restore-clipboard" {
+		if err := restoreClipboard(); err != nil {
+			os.Exit(exitError)
+		}
+		os.Exit(exitOK)
+	}
+	os.Exit(m.Run())
+}
+
+func readClipboard(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read clipboard: %v\n", err)
+	}
+	return string(data)
+}
+
+// waitForClipboard waits for the clipboard at path to hold want.
+func waitForClipboard(t *testing.T, path, want string) {
+	deadline := time.Now().Add(time.Second * 5)
+	for readClipboard(t, path) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("Wanted the clipboard to hold %q, got: %q\n", want, readClipboard(t, path))
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+}
+
+func TestCopyToClipboard(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "clipboard")
+	os.Setenv(fakeClipboardEnv, path)
+	defer os.Unsetenv(fakeClipboardEnv)
+	ioutil.WriteFile(path, []byte("previous"), 0600)
+
+	// Without a timeout the secret stays put
+	if err := copyToClipboard("secret", "fake", 0); err != nil {
+		t.Fatalf("unexpected error copying: %v\n", err)
+	}
+	if got := readClipboard(t, path); got != "secret" {
+		t.Fatalf("Wanted: 'secret', got: %q\n", got)
+	}
+
+	// The background process puts the previous contents back
+	ioutil.WriteFile(path, []byte("previous"), 0600)
+	if err := copyToClipboard("secret", "fake", 1); err != nil {
+		t.Fatalf("unexpected error copying: %v\n", err)
+	}
+	if got := readClipboard(t, path); got != "secret" {
+		t.Fatalf("Wanted: 'secret', got: %q\n", got)
+	}
+	waitForClipboard(t, path, "previous")
+
+	// Anything copied in the meantime is left alone
+	if err := copyToClipboard("secret", "fake", 1); err != nil {
+		t.Fatalf("unexpected error copying: %v\n", err)
+	}
+	ioutil.WriteFile(path, []byte("other"), 0600)
+	time.Sleep(time.Millisecond * 1500)
+	if got := readClipboard(t, path); got != "other" {
+		t.Fatalf("Wanted: 'other', got: %q\n", got)
+	}
+
+	if err := copyToClipboard("secret", "missing", 0); err == nil {
+		t.Fatalf("expected an error for an unknown clipboard command but got none")
+	}
+}
@@ -0,0 +1,105 @@
+// Package clipboard copies secrets to the system clipboard and removes them
+// again after a timeout.
+package clipboard
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Clipboard reads and writes the contents of a clipboard.
+type Clipboard interface {
+	Read() ([]byte, error)
+	Write(data []byte) error
+}
+
+// Command is a Clipboard that runs external programs to copy and paste.
+type Command struct {
+	Copy  []string
+	Paste []string
+}
+
+// Commands are the supported clipboard programs keyed by the name of their
+// copy command. They are listed in the order Detect tries them.
+var Commands = []struct {
+	Name    string
+	Command Command
+}{
+	{"wl-copy", Command{Copy: []string{"wl-copy"}, Paste: []string{"wl-paste", "--no-newline"}}},
+	{"xclip", Command{Copy: []string{"xclip", "-selection", "clipboard"}, Paste: []string{"xclip", "-selection", "clipboard", "-o"}}},
+	{"xsel", Command{Copy: []string{"xsel", "--clipboard", "--input"}, Paste: []string{"xsel", "--clipboard", "--output"}}},
+	{"pbcopy", Command{Copy: []string{"pbcopy"}, Paste: []string{"pbpaste"}}},
+}
+
+func (c Command) Read() ([]byte, error) {
+	out, err := exec.Command(c.Paste[0], c.Paste[1:]...).Output()
+	if err != nil {
+		return []byte{}, fmt.Errorf("unable to read clipboard with %s: %v", c.Paste[0], err)
+	}
+	return out, nil
+}
+
+func (c Command) Write(data []byte) error {
+	cmd := exec.Command(c.Copy[0], c.Copy[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("unable to write clipboard with %s: %v", c.Copy[0], err)
+	}
+	return nil
+}
+
+// Named returns the Command called name.
+func Named(name string) (Command, error) {
+	for _, c := range Commands {
+		if c.Name == name {
+			return c.Command, nil
+		}
+	}
+	return Command{}, fmt.Errorf("unknown clipboard command %q", name)
+}
+
+// Detect returns the first Command whose programs are installed. wl-copy is
+// only used under Wayland.
+func Detect() (Command, error) {
+	for _, c := range Commands {
+		if c.Name == "wl-copy" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			continue
+		}
+		if _, err := exec.LookPath(c.Command.Copy[0]); err != nil {
+			continue
+		}
+		if _, err := exec.LookPath(c.Command.Paste[0]); err != nil {
+			continue
+		}
+		return c.Command, nil
+	}
+	return Command{}, fmt.Errorf("no clipboard command found")
+}
+
+// Copy writes secret to cb and returns the previous contents so they can be
+// passed to Restore.
+func Copy(cb Clipboard, secret []byte) ([]byte, error) {
+	// An unreadable clipboard is usually just an empty one
+	previous, _ := cb.Read()
+	if err := cb.Write(secret); err != nil {
+		return []byte{}, err
+	}
+	return previous, nil
+}
+
+// Restore waits for d and then puts previous back on cb, but only if cb still
+// holds secret. Anything copied in the meantime is left alone.
+func Restore(cb Clipboard, secret, previous []byte, d time.Duration) error {
+	time.Sleep(d)
+	current, err := cb.Read()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, secret) {
+		return nil
+	}
+	return cb.Write(previous)
+}
@@ -0,0 +1,66 @@
+package clipboard
+
+import (
+	"testing"
+	"time"
+)
+
+type fake struct {
+	data []byte
+}
+
+func (f *fake) Read() ([]byte, error) {
+	return f.data, nil
+}
+
+func (f *fake) Write(data []byte) error {
+	f.data = data
+	return nil
+}
+
+func TestCopyRestore(t *testing.T) {
+	cb := &fake{data: []byte("previous")}
+	previous, err := Copy(cb, []byte("secret"))
+	if err != nil {
+		t.Fatalf("unexpected error copying: %v\n", err)
+	}
+	if string(cb.data) != "secret" {
+		t.Fatalf("Wanted: 'secret', got: %s\n", cb.data)
+	}
+	err = Restore(cb, []byte("secret"), previous, time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error restoring: %v\n", err)
+	}
+	if string(cb.data) != "previous" {
+		t.Fatalf("Wanted: 'previous', got: %s\n", cb.data)
+	}
+}
+
+func TestRestoreChanged(t *testing.T) {
+	cb := &fake{data: []byte("previous")}
+	previous, err := Copy(cb, []byte("secret"))
+	if err != nil {
+		t.Fatalf("unexpected error copying: %v\n", err)
+	}
+	cb.Write([]byte("newer"))
+	err = Restore(cb, []byte("secret"), previous, time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error restoring: %v\n", err)
+	}
+	if string(cb.data) != "newer" {
+		t.Fatalf("Wanted: 'newer', got: %s\n", cb.data)
+	}
+}
+
+func TestNamed(t *testing.T) {
+	c, err := Named("xclip")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if c.Copy[0] != "xclip" || c.Paste[0] != "xclip" {
+		t.Fatalf("unexpected command: %v\n", c)
+	}
+	if _, err := Named("nope"); err == nil {
+		t.Fatalf("expected error for unknown command but got none")
+	}
+}
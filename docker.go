@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/walkert/stash/client"
+)
+
+// dockerNotFound is the message Docker looks for to tell that a helper has
+// no credentials for a registry.
+const dockerNotFound = "credentials not found in native keychain"
+
+// dockerCredential is the JSON document used by Docker's credential helper
+// protocol.
+type dockerCredential struct {
+	ServerURL string `json:",omitempty"`
+	Username  string
+	Secret    string
+}
+
+func dockerEntryName(serverURL string) string {
+	return "docker:" + serverURL
+}
+
+func dockerGet(ctx context.Context, store secretStore, serverURL string) (dockerCredential, error) {
+	value, err := store.Get(ctx, dockerEntryName(serverURL))
+	if err != nil {
+		if client.ErrorKind(err) == client.KindNotSet {
+			return dockerCredential{}, fmt.Errorf(dockerNotFound)
+		}
+		return dockerCredential{}, err
+	}
+	var cred dockerCredential
+	if err := json.Unmarshal([]byte(value), &cred); err != nil {
+		return dockerCredential{}, fmt.Errorf("invalid credential for %s: %v", serverURL, err)
+	}
+	cred.ServerURL = serverURL
+	return cred, nil
+}
+
+// dockerCredentialHelper runs action for Docker's credential helper
+// protocol. Each registry's username and secret are stored as JSON in an
+// entry named after the registry.
+func dockerCredentialHelper(ctx context.Context, store secretStore, action string, in io.Reader, out io.Writer) error {
+	switch action {
+	case "store":
+		var cred dockerCredential
+		if err := json.NewDecoder(in).Decode(&cred); err != nil {
+			return fmt.Errorf("unable to read credential: %v", err)
+		}
+		if cred.ServerURL == "" {
+			return fmt.Errorf("credential is missing a server URL")
+		}
+		value, err := json.Marshal(dockerCredential{Username: cred.Username, Secret: cred.Secret})
+		if err != nil {
+			return err
+		}
+		return store.Set(ctx, dockerEntryName(cred.ServerURL), value)
+	case "get", "erase":
+		data, err := ioutil.ReadAll(in)
+		if err != nil {
+			return fmt.Errorf("unable to read server URL: %v", err)
+		}
+		serverURL := strings.TrimSpace(string(data))
+		if serverURL == "" {
+			return fmt.Errorf("no server URL given")
+		}
+		if action == "erase" {
+			err := store.Delete(ctx, dockerEntryName(serverURL))
+			if err != nil && client.ErrorKind(err) != client.KindNotSet {
+				return err
+			}
+			return nil
+		}
+		cred, err := dockerGet(ctx, store, serverURL)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(out).Encode(cred)
+	case "list":
+		creds := map[string]string{}
+		names, err := store.List(ctx)
+		if err != nil {
+			// Without a config nothing has been stored yet
+			if client.ErrorKind(err) == client.KindNotSet {
+				return json.NewEncoder(out).Encode(creds)
+			}
+			return err
+		}
+		for _, name := range names {
+			if !strings.HasPrefix(name, dockerEntryName("")) {
+				continue
+			}
+			serverURL := strings.TrimPrefix(name, dockerEntryName(""))
+			cred, err := dockerGet(ctx, store, serverURL)
+			if err != nil {
+				// The entry may have expired since it was listed
+				continue
+			}
+			creds[serverURL] = cred.Username
+		}
+		return json.NewEncoder(out).Encode(creds)
+	}
+	return fmt.Errorf("unknown action %q", action)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/walkert/stash/client"
+)
+
+func TestDockerCredentialHelper(t *testing.T) {
+	store := fakeStore{"other": "value"}
+	ctx := context.Background()
+	var out bytes.Buffer
+	in := `{"ServerURL":"https://registry.example.com","Username":"alice","Secret":"token"}`
+	if err := dockerCredentialHelper(ctx, store, "store", strings.NewReader(in), &out); err != nil {
+		t.Fatalf("unexpected error storing credential: %v\n", err)
+	}
+	if err := dockerCredentialHelper(ctx, store, "get", strings.NewReader("https://registry.example.com\n"), &out); err != nil {
+		t.Fatalf("unexpected error getting credential: %v\n", err)
+	}
+	want := `{"ServerURL":"https://registry.example.com","Username":"alice","Secret":"token"}` + "\n"
+	if out.String() != want {
+		t.Fatalf("Wanted: '%s', got: %s\n", want, out.String())
+	}
+	out.Reset()
+	if err := dockerCredentialHelper(ctx, store, "list", strings.NewReader(""), &out); err != nil {
+		t.Fatalf("unexpected error listing credentials: %v\n", err)
+	}
+	if out.String() != `{"https://registry.example.com":"alice"}`+"\n" {
+		t.Fatalf("unexpected list output: %s\n", out.String())
+	}
+	if err := dockerCredentialHelper(ctx, store, "erase", strings.NewReader("https://registry.example.com"), &out); err != nil {
+		t.Fatalf("unexpected error erasing credential: %v\n", err)
+	}
+	err := dockerCredentialHelper(ctx, store, "get", strings.NewReader("https://registry.example.com"), &out)
+	if err == nil || err.Error() != dockerNotFound {
+		t.Fatalf("Wanted error '%s', got: %v\n", dockerNotFound, err)
+	}
+	// Docker expects an empty object rather than an error when there's
+	// nothing to list
+	c, err := client.New("localhost:1", client.WithConfig(filepath.Join(os.TempDir(), "stash-missing-config")))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	for _, store := range []secretStore{fakeStore{}, c} {
+		out.Reset()
+		if err := dockerCredentialHelper(ctx, store, "list", strings.NewReader(""), &out); err != nil {
+			t.Fatalf("unexpected error listing credentials: %v\n", err)
+		}
+		if out.String() != "{}\n" {
+			t.Fatalf("Wanted an empty list, got: %s\n", out.String())
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/walkert/stash/client"
+)
+
+// Exit codes used by the client. These are documented in the README and
+// should not change.
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitAuth        = 2
+	exitUnreachable = 3
+	exitDecrypt     = 4
+	exitPolicy      = 5
+	exitLocked      = 6
+	exitNotSet      = 99
+)
+
+var output string
+
+// exitCode maps a client error onto one of the documented exit codes.
+func exitCode(err error) int {
+	switch client.ErrorKind(err) {
+	case client.KindNotSet:
+		return exitNotSet
+	case client.KindAuth:
+		return exitAuth
+	case client.KindUnreachable:
+		return exitUnreachable
+	case client.KindDecrypt:
+		return exitDecrypt
+	case client.KindPolicy:
+		return exitPolicy
+	case client.KindLocked:
+		return exitLocked
+	}
+	return exitError
+}
+
+// fail reports err in the selected output format and exits with the code
+// that matches it.
+func fail(err error) {
+	code := exitCode(err)
+	if output == "json" {
+		printJSON(struct {
+			Error string `json:"error"`
+			Code  int    `json:"code"`
+		}{Error: strings.TrimSpace(err.Error()), Code: code})
+		os.Exit(code)
+	}
+	log.Errorf("ERROR: %v\n", err)
+	os.Exit(code)
+}
+
+func printJSON(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Fatalf("ERROR: unable to encode output: %v\n", err)
+	}
+	fmt.Println(string(data))
+}
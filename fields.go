@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// entryFields returns the fields given as name=value with --field, asking
+// for the value of each field named with --prompt.
+func entryFields(specs, prompts []string, ask func(prompt string, mask bool) ([]byte, error)) (map[string][]byte, error) {
+	fields := map[string][]byte{}
+	for _, spec := range specs {
+		spl := strings.SplitN(spec, "=", 2)
+		if len(spl) != 2 || spl[0] == "" {
+			return nil, fmt.Errorf("invalid field %q, expected name=value", spec)
+		}
+		fields[spl[0]] = []byte(spl[1])
+	}
+	for _, name := range prompts {
+		value, err := ask(fmt.Sprintf("%s: ", name), true)
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = value
+	}
+	return fields, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEntryFields(t *testing.T) {
+	var prompts []string
+	ask := func(prompt string, mask bool) ([]byte, error) {
+		prompts = append(prompts, prompt)
+		return []byte("typed"), nil
+	}
+	fields, err := entryFields([]string{"user=alice", "url=https://example.com/?a=b"}, []string{"password"}, ask)
+	if err != nil {
+		t.Fatalf("unexpected error parsing fields: %v\n", err)
+	}
+	want := map[string]string{"user": "alice", "url": "https://example.com/?a=b", "password": "typed"}
+	if len(fields) != len(want) {
+		t.Fatalf("Wanted: %v, got: %q\n", want, fields)
+	}
+	for name, value := range want {
+		if string(fields[name]) != value {
+			t.Fatalf("Wanted %s to be '%s', got: %s\n", name, value, fields[name])
+		}
+	}
+	if len(prompts) != 1 || prompts[0] != "password: " {
+		t.Fatalf("unexpected prompts: %q\n", prompts)
+	}
+	if _, err := entryFields([]string{"user"}, nil, ask); err == nil {
+		t.Fatalf("expected error for a field without a value but got none")
+	}
+}
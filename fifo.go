@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// newFifo atomically replaces the file at path with a new FIFO.
+func newFifo(path string) error {
+	tmp := fmt.Sprintf("%s.%d", path, os.Getpid())
+	if err := syscall.Mkfifo(tmp, 0600); err != nil {
+		return fmt.Errorf("unable to create %s: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("unable to create %s: %v", path, err)
+	}
+	return nil
+}
+
+// serveFifo creates a FIFO at path and writes the value returned by get to
+// each reader that opens it, so the secret never touches the disk. It stops
+// after reads opens if reads is positive, when check returns an error or on
+// a signal, removing the FIFO in every case. check is called as often as
+// the server's watchdog runs so the FIFO goes soon after the entry expires,
+// and before waiting for each reader so that nobody is handed an empty
+// secret for an entry that has already gone.
+func serveFifo(path string, reads int, get func() (string, error), check func() error) error {
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	if err := check(); err != nil {
+		return err
+	}
+	if err := newFifo(path); err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	done := make(chan error, 1)
+	go func() {
+		for served := 0; reads <= 0 || served < reads; served++ {
+			if served > 0 {
+				if err := check(); err != nil {
+					done <- err
+					return
+				}
+			}
+			// Blocks until a reader opens the FIFO
+			fifo, err := os.OpenFile(path, os.O_WRONLY, 0)
+			if err != nil {
+				done <- fmt.Errorf("unable to open %s: %v", path, err)
+				return
+			}
+			// The value is fetched for every reader so that a replaced or
+			// expired entry is noticed straight away
+			value, err := get()
+			if err != nil {
+				fifo.Close()
+				done <- err
+				return
+			}
+			// Readers that go away early aren't an error
+			fifo.WriteString(value)
+			// Every reader gets a FIFO of its own. Reopening this one could
+			// hand the secret to the same reader again if it hadn't yet seen
+			// the end of the data. The new one is in place before this one
+			// is closed so nobody opens a FIFO that has lost its writer.
+			if err := newFifo(path); err != nil {
+				fifo.Close()
+				done <- err
+				return
+			}
+			fifo.Close()
+		}
+		done <- nil
+	}()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	ticker := time.NewTicker(time.Second * 5)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-sigs:
+			return nil
+		case <-ticker.C:
+			if err := check(); err != nil {
+				return err
+			}
+		}
+	}
+}
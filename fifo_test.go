@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServeFifo(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fifo")
+	get := func() (string, error) { return "secret", nil }
+	check := func() error { return nil }
+	done := make(chan error, 1)
+	go func() {
+		done <- serveFifo(path, 2, get, check)
+	}()
+	for i := 0; i < 2; i++ {
+		// Wait for the FIFO to be created
+		deadline := time.Now().Add(time.Second * 5)
+		for {
+			if _, err := os.Stat(path); err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s wasn't created\n", path)
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("unexpected error reading fifo: %v\n", err)
+		}
+		if string(data) != "secret" {
+			t.Fatalf("Wanted: 'secret', got: %s\n", data)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error serving fifo: %v\n", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected the fifo to be removed after the last read, got: %v\n", err)
+	}
+	// Nothing is served for an entry that has gone
+	gone := func() error { return fmt.Errorf("gone") }
+	if err := serveFifo(path, 1, get, gone); err == nil {
+		t.Fatalf("expected an error serving a missing entry but got none")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no fifo for a missing entry, got: %v\n", err)
+	}
+}
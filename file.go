@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/walkert/stash/client"
+)
+
+// putFile stores the contents of the file at path in the entry called name.
+func putFile(ctx context.Context, c *client.Client, name, path string, opts ...client.SetOption) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %v", path, err)
+	}
+	defer file.Close()
+	return c.Upload(ctx, name, file, opts...)
+}
+
+// createPrivate creates or truncates the file at path, making sure only its
+// owner can read it.
+func createPrivate(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %s: %v", path, err)
+	}
+	// OpenFile leaves the mode of an existing file alone
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("unable to restrict %s: %v", path, err)
+	}
+	return file, nil
+}
+
+// getFile writes the entry called name to the file at path, or to stdout if
+// path is empty. The file is only readable by its owner. It's written to a
+// temporary file alongside path first so that an existing file is only
+// replaced once the whole entry has been downloaded.
+func getFile(ctx context.Context, c *client.Client, name, path string) error {
+	if path == "" {
+		return c.Download(ctx, name, os.Stdout)
+	}
+	// TempFile creates the file with mode 0600
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %v", path, err)
+	}
+	defer os.Remove(file.Name())
+	if err := c.Download(ctx, name, file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("unable to write %s: %v", path, err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("unable to write %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/walkert/stash/client"
+)
+
+func TestGetFileKeepsOutput(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	// Without a config every download fails
+	c, err := client.New("localhost:1", client.WithConfig(filepath.Join(dir, "missing")))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	path := filepath.Join(dir, "out")
+	ioutil.WriteFile(path, []byte("previous"), 0600)
+	if err := getFile(context.Background(), c, "key", path); err == nil {
+		t.Fatalf("expected an error downloading but got none")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil || string(data) != "previous" {
+		t.Fatalf("Wanted %s to be left alone, got: %q (%v)\n", path, data, err)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("Wanted only %s to be left, got %d files\n", path, len(files))
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/walkert/stash/client"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Files encrypted by stash start with a header holding the format version,
+// the scrypt parameters used to derive the key, the salt and the nonce. The
+// header is authenticated along with the data so none of it can be changed
+// without decryption failing.
+//
+//	magic   [6]byte "STASH\x00"
+//	version uint8
+//	logN    uint8
+//	r       uint32
+//	p       uint32
+//	salt    [16]byte
+//	nonce   [12]byte
+const (
+	fileMagic   = "STASH\x00"
+	fileVersion = 1
+	saltSize    = 16
+	headerSize  = len(fileMagic) + 1 + 1 + 4 + 4 + saltSize
+)
+
+// fileParams are the scrypt parameters for newly encrypted files. They use
+// 128MB of memory and take around half a second, which is only paid once per
+// file as the passphrase itself comes from the stash.
+var fileParams = struct {
+	logN uint8
+	r, p uint32
+}{logN: 17, r: 8, p: 1}
+
+// maxFileMemory is the most memory scrypt may use to derive a file's key.
+// The parameters come from the file so they mustn't be able to exhaust
+// memory or take minutes to derive.
+const maxFileMemory = 256 << 20
+
+func fileKey(passphrase, salt []byte, logN uint8, r, p uint32) (cipher.AEAD, error) {
+	// scrypt needs 128*r*N bytes and p multiplies the time taken
+	if logN < 10 || logN > 30 || r == 0 || p == 0 || p > 4 || 128*uint64(r)<<logN > maxFileMemory {
+		return nil, fmt.Errorf("invalid key derivation parameters")
+	}
+	key, err := scrypt.Key(passphrase, salt, 1<<logN, int(r), int(p), 32)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptData encrypts data with a key derived from passphrase.
+func encryptData(passphrase, data []byte) ([]byte, error) {
+	var header bytes.Buffer
+	header.WriteString(fileMagic)
+	header.WriteByte(fileVersion)
+	header.WriteByte(fileParams.logN)
+	binary.Write(&header, binary.BigEndian, fileParams.r)
+	binary.Write(&header, binary.BigEndian, fileParams.p)
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("unable to generate salt: %v", err)
+	}
+	header.Write(salt)
+	aead, err := fileKey(passphrase, salt, fileParams.logN, fileParams.r, fileParams.p)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("unable to generate nonce: %v", err)
+	}
+	header.Write(nonce)
+	return aead.Seal(header.Bytes(), nonce, data, header.Bytes()), nil
+}
+
+// decryptData reverses encryptData.
+func decryptData(passphrase, data []byte) ([]byte, error) {
+	if len(data) < headerSize || string(data[:len(fileMagic)]) != fileMagic {
+		return nil, fmt.Errorf("not a file encrypted by stash")
+	}
+	header := data[len(fileMagic):]
+	if version := header[0]; version != fileVersion {
+		return nil, fmt.Errorf("unsupported file version %d", version)
+	}
+	logN := header[1]
+	r := binary.BigEndian.Uint32(header[2:6])
+	p := binary.BigEndian.Uint32(header[6:10])
+	salt := header[10 : 10+saltSize]
+	aead, err := fileKey(passphrase, salt, logN, r, p)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < headerSize+aead.NonceSize() {
+		return nil, fmt.Errorf("file is truncated")
+	}
+	nonce := data[headerSize : headerSize+aead.NonceSize()]
+	plain, err := aead.Open(nil, nonce, data[headerSize+aead.NonceSize():], data[:headerSize+aead.NonceSize()])
+	if err != nil {
+		return nil, &client.Error{Kind: client.KindDecrypt, Err: fmt.Errorf("unable to decrypt: wrong passphrase or the file has been modified")}
+	}
+	return plain, nil
+}
+
+// readInput reads the file at path, or stdin if path is "-".
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// writeOutput writes data to the file at path, readable only by its owner,
+// or to stdout if path is "-".
+func writeOutput(path string, data []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	file, err := createPrivate(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("unable to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// cryptFile encrypts or decrypts the file at in, writing the result to out,
+// using passphrase as the key.
+func cryptFile(decrypt bool, passphrase []byte, in, out string) error {
+	data, err := readInput(in)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %v", in, err)
+	}
+	if decrypt {
+		data, err = decryptData(passphrase, data)
+	} else {
+		data, err = encryptData(passphrase, data)
+	}
+	if err != nil {
+		return err
+	}
+	return writeOutput(out, data)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestEncryptData(t *testing.T) {
+	// Keep the test fast
+	params := fileParams
+	fileParams.logN = 10
+	defer func() { fileParams = params }()
+	data := []byte("secrets bundle")
+	encrypted, err := encryptData([]byte("passphrase"), data)
+	if err != nil {
+		t.Fatalf("unexpected error encrypting: %v\n", err)
+	}
+	if bytes.Contains(encrypted, data) {
+		t.Fatalf("encrypted data contains the plain text")
+	}
+	decrypted, err := decryptData([]byte("passphrase"), encrypted)
+	if err != nil {
+		t.Fatalf("unexpected error decrypting: %v\n", err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Fatalf("Wanted: '%s', got: %s\n", data, decrypted)
+	}
+	if _, err := decryptData([]byte("wrong"), encrypted); err == nil {
+		t.Fatalf("expected error decrypting with the wrong passphrase but got none")
+	}
+	// The header is authenticated too
+	tampered := append([]byte{}, encrypted...)
+	tampered[headerSize-1] ^= 1
+	if _, err := decryptData([]byte("passphrase"), tampered); err == nil {
+		t.Fatalf("expected error decrypting a modified file but got none")
+	}
+	tampered = append([]byte{}, encrypted...)
+	tampered[len(fileMagic)] = 2
+	if _, err := decryptData([]byte("passphrase"), tampered); err == nil {
+		t.Fatalf("expected error decrypting an unknown version but got none")
+	}
+	// Parameters from the header which would use too much memory or time
+	// are refused before deriving the key
+	for _, params := range []struct {
+		logN uint8
+		r, p uint32
+	}{
+		{20, 32, 1},
+		{18, 16, 1},
+		{10, 1 << 20, 1},
+		{17, 8, 16},
+	} {
+		tampered = append([]byte{}, encrypted...)
+		tampered[len(fileMagic)+1] = params.logN
+		binary.BigEndian.PutUint32(tampered[len(fileMagic)+2:], params.r)
+		binary.BigEndian.PutUint32(tampered[len(fileMagic)+6:], params.p)
+		if _, err := decryptData([]byte("passphrase"), tampered); err == nil || err.Error() != "invalid key derivation parameters" {
+			t.Fatalf("expected parameters %+v to be refused, got: %v\n", params, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/walkert/stash/client"
+)
+
+// awsCredentials is the document expected from an AWS credential_process.
+// An entry holds each value as a field of the same name.
+type awsCredentials struct {
+	Version         int
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	SessionToken    string `json:",omitempty"`
+	Expiration      string `json:",omitempty"`
+}
+
+// execCredential is the document expected from a kubectl exec credential
+// plugin.
+type execCredential struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Status     struct {
+		Token               string `json:"token"`
+		ExpirationTimestamp string `json:"expirationTimestamp,omitempty"`
+	} `json:"status"`
+}
+
+// formatCredential renders the fields of an entry, which expires at
+// expires, in the format expected by another tool.
+func formatCredential(format string, fields map[string]string, expires time.Time) ([]byte, error) {
+	var expiration string
+	if !expires.IsZero() {
+		expiration = expires.UTC().Format(time.RFC3339)
+	}
+	switch format {
+	case "aws-credential-process":
+		creds := awsCredentials{
+			Version:         1,
+			AccessKeyID:     fields["AccessKeyId"],
+			SecretAccessKey: fields["SecretAccessKey"],
+			SessionToken:    fields["SessionToken"],
+			Expiration:      expiration,
+		}
+		if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+			return nil, fmt.Errorf("entry is missing the AccessKeyId or SecretAccessKey field")
+		}
+		// Temporary credentials expire by themselves, possibly before the
+		// entry does
+		if stored := fields["Expiration"]; stored != "" {
+			t, err := time.Parse(time.RFC3339, stored)
+			if err != nil {
+				return nil, fmt.Errorf("entry has an invalid Expiration field: %v", err)
+			}
+			if expires.IsZero() || t.Before(expires) {
+				creds.Expiration = t.UTC().Format(time.RFC3339)
+			}
+		}
+		return json.Marshal(creds)
+	case "k8s-exec-credential":
+		cred := execCredential{APIVersion: "client.authentication.k8s.io/v1beta1", Kind: "ExecCredential"}
+		// kubectl describes the version it wants in the environment
+		var info struct {
+			APIVersion string `json:"apiVersion"`
+		}
+		if err := json.Unmarshal([]byte(os.Getenv("KUBERNETES_EXEC_INFO")), &info); err == nil && info.APIVersion != "" {
+			cred.APIVersion = info.APIVersion
+		}
+		value, ok := fields[client.PasswordField]
+		if !ok {
+			return nil, fmt.Errorf("entry has no password")
+		}
+		// The entry is either a bare token or a JSON object with a token
+		var stored struct {
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal([]byte(value), &stored); err == nil && stored.Token != "" {
+			value = stored.Token
+		}
+		cred.Status.Token = value
+		cred.Status.ExpirationTimestamp = expiration
+		return json.Marshal(cred)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFormatCredential(t *testing.T) {
+	expires := time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)
+	aws := map[string]string{"AccessKeyId": "AK", "SecretAccessKey": "SK", "SessionToken": "ST"}
+	// Temporary credentials carry their own expiry
+	session := map[string]string{"AccessKeyId": "AK", "SecretAccessKey": "SK", "Expiration": "2019-07-01T10:00:00Z"}
+	tests := []struct {
+		format  string
+		fields  map[string]string
+		expires time.Time
+		want    string
+	}{
+		{"aws-credential-process", aws, expires, `{"Version":1,"AccessKeyId":"AK","SecretAccessKey":"SK","SessionToken":"ST","Expiration":"2019-07-01T12:00:00Z"}`},
+		{"aws-credential-process", aws, time.Time{}, `{"Version":1,"AccessKeyId":"AK","SecretAccessKey":"SK","SessionToken":"ST"}`},
+		{"aws-credential-process", session, expires, `{"Version":1,"AccessKeyId":"AK","SecretAccessKey":"SK","Expiration":"2019-07-01T10:00:00Z"}`},
+		{"aws-credential-process", session, expires.Add(-time.Hour * 3), `{"Version":1,"AccessKeyId":"AK","SecretAccessKey":"SK","Expiration":"2019-07-01T09:00:00Z"}`},
+		{"aws-credential-process", session, time.Time{}, `{"Version":1,"AccessKeyId":"AK","SecretAccessKey":"SK","Expiration":"2019-07-01T10:00:00Z"}`},
+		{"k8s-exec-credential", map[string]string{"password": "token"}, expires, `{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential","status":{"token":"token","expirationTimestamp":"2019-07-01T12:00:00Z"}}`},
+		{"k8s-exec-credential", map[string]string{"password": `{"token":"nested"}`}, time.Time{}, `{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential","status":{"token":"nested"}}`},
+	}
+	os.Unsetenv("KUBERNETES_EXEC_INFO")
+	for _, test := range tests {
+		got, err := formatCredential(test.format, test.fields, test.expires)
+		if err != nil {
+			t.Fatalf("unexpected error formatting %s: %v\n", test.format, err)
+		}
+		if string(got) != test.want {
+			t.Fatalf("Wanted: '%s', got: %s\n", test.want, got)
+		}
+	}
+	if _, err := formatCredential("aws-credential-process", map[string]string{"password": "AK"}, expires); err == nil {
+		t.Fatalf("expected error formatting an entry without AWS fields but got none")
+	}
+	session["Expiration"] = "tomorrow"
+	if _, err := formatCredential("aws-credential-process", session, expires); err == nil {
+		t.Fatalf("expected error formatting an invalid Expiration but got none")
+	}
+}
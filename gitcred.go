@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/walkert/stash/client"
+)
+
+// secretStore is the part of client.Client used by the credential helpers.
+type secretStore interface {
+	Get(ctx context.Context, name string) (string, error)
+	Set(ctx context.Context, name string, value []byte, opts ...client.SetOption) error
+	Delete(ctx context.Context, name string) error
+	List(ctx context.Context) ([]string, error)
+}
+
+// storeWithOptions adds opts to every Set so that flags such as --ttl apply
+// to entries stored by the helpers.
+type storeWithOptions struct {
+	secretStore
+	opts []client.SetOption
+}
+
+func (s storeWithOptions) Set(ctx context.Context, name string, value []byte, opts ...client.SetOption) error {
+	all := append(append([]client.SetOption{}, s.opts...), opts...)
+	return s.secretStore.Set(ctx, name, value, all...)
+}
+
+// readGitCredential parses git's credential helper format: key=value lines
+// terminated by a blank line or EOF.
+func readGitCredential(r io.Reader) (map[string]string, error) {
+	cred := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		spl := strings.SplitN(line, "=", 2)
+		if len(spl) != 2 {
+			return nil, fmt.Errorf("invalid credential line %q", line)
+		}
+		cred[spl[0]] = spl[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read credential: %v", err)
+	}
+	return cred, nil
+}
+
+// gitEntryName maps a credential onto the name of the stash entry holding
+// it. The username is part of the name, as in a URL, so that each account on
+// a host has an entry of its own.
+func gitEntryName(cred map[string]string) (string, error) {
+	if cred["protocol"] == "" || cred["host"] == "" {
+		return "", fmt.Errorf("credential is missing a protocol or host")
+	}
+	location := gitLocation(cred)
+	if cred["username"] != "" {
+		location = url.User(cred["username"]).String() + "@" + location
+	}
+	return fmt.Sprintf("git:%s://%s", cred["protocol"], location), nil
+}
+
+// gitLocation returns the host and path of a credential.
+func gitLocation(cred map[string]string) string {
+	if cred["path"] != "" {
+		return cred["host"] + "/" + cred["path"]
+	}
+	return cred["host"]
+}
+
+// gitEntries returns the names of the entries holding credentials for the
+// host and path of cred whatever their username. Ones without a username
+// come first.
+func gitEntries(ctx context.Context, store secretStore, cred map[string]string) ([]string, error) {
+	names, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prefix := fmt.Sprintf("git:%s://", cred["protocol"])
+	location := gitLocation(cred)
+	var matches []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(name, prefix)
+		if rest == location {
+			matches = append([]string{name}, matches...)
+			continue
+		}
+		// Escaped usernames never contain an @
+		if spl := strings.SplitN(rest, "@", 2); len(spl) == 2 && spl[1] == location {
+			matches = append(matches, name)
+		}
+	}
+	return matches, nil
+}
+
+// gitCredential runs action for git's credential helper protocol. The
+// username and password are stored together in a single entry using git's
+// own format. Without a username, get returns the first credential for the
+// host and erase removes every one.
+func gitCredential(ctx context.Context, store secretStore, action string, in io.Reader, out io.Writer) error {
+	cred, err := readGitCredential(in)
+	if err != nil {
+		return err
+	}
+	name, err := gitEntryName(cred)
+	if err != nil {
+		return err
+	}
+	names := []string{name}
+	if cred["username"] == "" && action != "store" {
+		if names, err = gitEntries(ctx, store, cred); err != nil {
+			if client.ErrorKind(err) == client.KindNotSet {
+				return nil
+			}
+			return err
+		}
+	}
+	switch action {
+	case "get":
+		for _, name := range names {
+			value, err := store.Get(ctx, name)
+			if err != nil {
+				// Git will ask the user instead
+				if client.ErrorKind(err) == client.KindNotSet {
+					continue
+				}
+				return err
+			}
+			stored, err := readGitCredential(strings.NewReader(value))
+			if err != nil {
+				return err
+			}
+			if cred["username"] != "" && cred["username"] != stored["username"] {
+				continue
+			}
+			fmt.Fprintf(out, "username=%s\npassword=%s\n", stored["username"], stored["password"])
+			return nil
+		}
+	case "store":
+		if cred["password"] == "" {
+			return nil
+		}
+		value := fmt.Sprintf("username=%s\npassword=%s\n", cred["username"], cred["password"])
+		return store.Set(ctx, name, []byte(value))
+	case "erase":
+		for _, name := range names {
+			err := store.Delete(ctx, name)
+			if err != nil && client.ErrorKind(err) != client.KindNotSet {
+				return err
+			}
+		}
+	}
+	// Git may add new actions in future so unknown ones are ignored
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/walkert/stash/client"
+)
+
+type fakeStore map[string]string
+
+func (f fakeStore) Get(ctx context.Context, name string) (string, error) {
+	value, ok := f[name]
+	if !ok {
+		return "", &client.Error{Kind: client.KindNotSet, Err: fmt.Errorf("%s not set", name)}
+	}
+	return value, nil
+}
+
+func (f fakeStore) Set(ctx context.Context, name string, value []byte, opts ...client.SetOption) error {
+	f[name] = string(value)
+	return nil
+}
+
+func (f fakeStore) Upload(ctx context.Context, name string, r io.Reader, opts ...client.SetOption) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	f[name] = string(data)
+	return nil
+}
+
+func (f fakeStore) Delete(ctx context.Context, name string) error {
+	if _, ok := f[name]; !ok {
+		return &client.Error{Kind: client.KindNotSet, Err: fmt.Errorf("%s not set", name)}
+	}
+	delete(f, name)
+	return nil
+}
+
+func (f fakeStore) List(ctx context.Context) ([]string, error) {
+	var names []string
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func TestGitCredential(t *testing.T) {
+	store := fakeStore{}
+	ctx := context.Background()
+	var out bytes.Buffer
+	for _, in := range []string{
+		"protocol=https\nhost=example.com\nusername=alice\npassword=secret\n\n",
+		"protocol=https\nhost=example.com\nusername=bob@corp\npassword=other\n\n",
+	} {
+		if err := gitCredential(ctx, store, "store", strings.NewReader(in), &out); err != nil {
+			t.Fatalf("unexpected error storing credential: %v\n", err)
+		}
+	}
+	// Each account on a host has its own entry
+	for _, name := range []string{"git:https://alice@example.com", "git:https://bob%40corp@example.com"} {
+		if _, ok := store[name]; !ok {
+			t.Fatalf("credential not stored under %s: %v\n", name, store)
+		}
+	}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"protocol=https\nhost=example.com\n", "username=alice\npassword=secret\n"},
+		{"protocol=https\nhost=example.com\nusername=alice\n", "username=alice\npassword=secret\n"},
+		{"protocol=https\nhost=example.com\nusername=bob@corp\n", "username=bob@corp\npassword=other\n"},
+		{"protocol=https\nhost=example.com\nusername=carol\n", ""},
+		{"protocol=https\nhost=other.com\n", ""},
+	}
+	for _, test := range tests {
+		out.Reset()
+		if err := gitCredential(ctx, store, "get", strings.NewReader(test.in), &out); err != nil {
+			t.Fatalf("unexpected error getting credential: %v\n", err)
+		}
+		if out.String() != test.want {
+			t.Fatalf("Wanted: '%s', got: %s\n", test.want, out.String())
+		}
+	}
+	if err := gitCredential(ctx, store, "erase", strings.NewReader("protocol=https\nhost=example.com\nusername=alice\n"), &out); err != nil {
+		t.Fatalf("unexpected error erasing credential: %v\n", err)
+	}
+	if _, ok := store["git:https://bob%40corp@example.com"]; !ok || len(store) != 1 {
+		t.Fatalf("expected only alice's credential to be erased: %v\n", store)
+	}
+	if err := gitCredential(ctx, store, "erase", strings.NewReader("protocol=https\nhost=example.com\n"), &out); err != nil {
+		t.Fatalf("unexpected error erasing credential: %v\n", err)
+	}
+	if len(store) != 0 {
+		t.Fatalf("credential not erased: %v\n", store)
+	}
+	if err := gitCredential(ctx, store, "get", strings.NewReader("host=example.com\n"), &out); err == nil {
+		t.Fatalf("expected error for credential without a protocol but got none")
+	}
+}
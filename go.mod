@@ -10,5 +10,7 @@ require (
 	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/pflag v1.0.3
 	github.com/walkert/cipher v0.0.2
+	github.com/walkert/go-evp v0.0.0-20170514035756-ffd5184bbd4e
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 	google.golang.org/grpc v1.22.0
 )
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path"
 	"strings"
 	"syscall"
+	"time"
 
-	"github.com/mattn/go-isatty"
 	"github.com/mitchellh/go-homedir"
 	log "github.com/sirupsen/logrus"
 	flag "github.com/spf13/pflag"
@@ -22,6 +25,16 @@ const (
 	confName = ".stash"
 )
 
+// progCommands maps the names stash can be invoked as onto the command that
+// name implies.
+var progCommands = map[string]string{
+	"docker-credential-stash": "credential-docker",
+	"git-credential-stash":    "credential-git",
+	"pinentry-stash":          "pinentry",
+	"stash-askpass":           "askpass",
+	"stash-native-host":       "native-host",
+}
+
 var (
 	auth       string
 	certFile   string
@@ -31,6 +44,7 @@ var (
 	host       string
 	keyFile    string
 	port       int
+	timeout    time.Duration
 	verbose    bool
 )
 
@@ -56,50 +70,307 @@ func setConfig() {
 	)
 }
 
-func obscure(s string) {
-	if !isatty.IsTerminal(os.Stdout.Fd()) {
-		fmt.Println(s)
+func printStatus(st client.Status) {
+	if output == "json" {
+		out := struct {
+			Set       bool       `json:"set"`
+			Expires   *time.Time `json:"expires,omitempty"`
+			ReadsLeft int        `json:"reads_left,omitempty"`
+			Locked    bool       `json:"locked,omitempty"`
+		}{Set: st.Set, ReadsLeft: st.ReadsLeft, Locked: st.Locked}
+		if !st.Expires.IsZero() {
+			out.Expires = &st.Expires
+		}
+		printJSON(out)
 		return
 	}
-	fg, _ := exec.Command("tput", "setaf", "7").Output()
-	bg, _ := exec.Command("tput", "setab", "7").Output()
-	reset, _ := exec.Command("tput", "sgr", "0").Output()
-	fmt.Printf("%s%s%s%s\n", string(fg), string(bg), s, string(reset))
+	var notes []string
+	if st.Locked {
+		notes = append(notes, "locked")
+	}
+	switch st.ReadsLeft {
+	case 0:
+	case 1:
+		notes = append(notes, "1 read left")
+	default:
+		notes = append(notes, fmt.Sprintf("%d reads left", st.ReadsLeft))
+	}
+	var reads string
+	if len(notes) > 0 {
+		reads = fmt.Sprintf(" (%s)", strings.Join(notes, ", "))
+	}
+	switch {
+	case !st.Set:
+		fmt.Println("Password not set")
+	case st.Expires.IsZero():
+		fmt.Printf("Password set%s\n", reads)
+	default:
+		fmt.Printf("Password set, expires at %s%s\n", st.Expires.Format("2006-01-02 15:04:05"), reads)
+	}
+}
+
+// passwordSource returns the source selected by the --stdin, --from-file and
+// --from-env flags, falling back to prompting the user.
+func passwordSource(stdin bool, file, env string, confirm bool) (client.PasswordSource, error) {
+	var sources []client.PasswordSource
+	if stdin {
+		sources = append(sources, client.ReaderSource(os.Stdin))
+	}
+	if file != "" {
+		sources = append(sources, client.FileSource(file))
+	}
+	if env != "" {
+		sources = append(sources, client.EnvSource(env))
+	}
+	switch len(sources) {
+	case 0:
+		if confirm {
+			return client.ConfirmPromptSource(), nil
+		}
+		return client.PromptSource(), nil
+	case 1:
+		return sources[0], nil
+	}
+	return nil, fmt.Errorf("only one of --stdin, --from-file and --from-env may be used")
+}
+
+// readPIN reads a PIN from stdin or asks for it on the terminal, twice if
+// confirm is set.
+func readPIN(stdin, confirm bool) ([]byte, error) {
+	if stdin {
+		return client.ReaderSource(os.Stdin)()
+	}
+	pin, err := ttyPrompt("", "PIN: ", true)
+	if err != nil || !confirm {
+		return pin, err
+	}
+	again, err := ttyPrompt("", "Confirm PIN: ", true)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pin, again) {
+		return nil, fmt.Errorf("PINs do not match")
+	}
+	return pin, nil
+}
+
+func parseClasses(names []string) ([]client.Class, error) {
+	var classes []client.Class
+	for _, name := range names {
+		class, err := client.ParseClass(name)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, class)
+	}
+	return classes, nil
+}
+
+// passwordPolicies returns the policies selected by the --min-length,
+// --require and --min-strength flags.
+func passwordPolicies(minLength int, require []string, minStrength float64) ([]client.Policy, error) {
+	var policies []client.Policy
+	if minLength > 0 {
+		policies = append(policies, client.MinLength(minLength))
+	}
+	if len(require) > 0 {
+		classes, err := parseClasses(require)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, client.RequireClasses(classes...))
+	}
+	if minStrength > 0 {
+		policies = append(policies, client.MinStrength(minStrength))
+	}
+	return policies, nil
+}
+
+// parseClock parses a local time of day given as HH:MM.
+func parseClock(value string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// startDaemon runs this binary again in the background with the same
+// arguments, less --daemon, and returns its pid.
+func startDaemon() (int, error) {
+	binary, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return 0, err
+	}
+	args := []string{binary}
+	for _, arg := range os.Args[1:] {
+		if arg == "--daemon" {
+			continue
+		}
+		args = append(args, arg)
+	}
+	// The daemon mustn't hold on to our output, which may be read by a
+	// command substitution waiting for it to close
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer null.Close()
+	files := []uintptr{null.Fd(), null.Fd(), null.Fd()}
+	return syscall.ForkExec(binary, args, &syscall.ProcAttr{Env: os.Environ(), Files: files, Sys: &syscall.SysProcAttr{Setsid: true}})
 }
 
 func main() {
+	allowOrigins := flag.StringSlice("allow-origin", nil, "the browser extension `origins` allowed to use native-host")
 	asClient := flag.Bool("client", true, "run in client mode")
-	daemon := flag.Bool("daemon", false, "run the server as a daemon")
+	askpassMode := flag.Bool("askpass", false, "act as an SSH_ASKPASS or SUDO_ASKPASS program")
+	charset := flag.StringSlice("charset", nil, "the character `classes` used by generate (lower, upper, digit, symbol)")
+	bindParent := flag.Bool("bind-parent", false, "drop entries set by this client when the process that ran it exits")
+	bindPID := flag.Int("bind-pid", 0, "drop entries set by this client when the process `pid` exits")
+	clip := flag.Bool("clip", false, "copy the password to the clipboard instead of printing it")
+	clipCommand := flag.String("clip-command", "", "the clipboard `command` to use (wl-copy, xclip, xsel or pbcopy), detected if not set")
+	clipTimeout := flag.Int("clip-timeout", 45, "restore the previous clipboard contents after this many `seconds`, 0 to disable")
+	confirm := flag.Bool("confirm", false, "ask for the password twice when setting it")
+	daemon := flag.Bool("daemon", false, "run the server or ssh-agent as a daemon")
 	asServer := flag.Bool("server", false, "run in server mode")
 	flag.StringVar(&certFile, "cert-file", "", "the TLS certificate file to use")
+	env := flag.String("env", "", "the environment `variable` exec sets to the password")
+	excludeAmbiguous := flag.Bool("exclude-ambiguous", false, "don't generate easily confused characters such as 'l', '1' and 'O'")
+	expireAt := flag.String("expire-at", "", "drop entries set by this client at this local `time` (HH:MM), or in server mode drop everything at it every day")
 	flag.IntVar(&expiration, "expiration", 12, "The amount of time in `hours` after which the stash should expire")
+	fields := flag.StringArray("field", nil, "the `field` get prints, or a name=value field set stores (may be repeated)")
+	format := flag.String("format", "", "print the entry for another tool (aws-credential-process or k8s-exec-credential)")
+	fromEnv := flag.String("from-env", "", "read the password to set from the environment `variable`")
+	fromFile := flag.String("from-file", "", "read the password to set from the file at `path`")
+	generate := flag.Bool("generate", false, "generate a random password and set it")
 	get := flag.Bool("get", false, "get data")
 	help := flag.Bool("help", false, "show help")
-	flag.StringVar(&host, "host", "localhost", "the hostname to listen on")
+	flag.StringVar(&host, "host", "localhost", "the hostname to listen on or connect to")
 	flag.StringVar(&keyFile, "key-file", "", "the TLS key file to use")
+	length := flag.Int("length", 20, "the number of characters in a generated password")
+	maxEntrySize := flag.Int64("max-entry-size", server.DefaultMaxSize, "the largest entry in `bytes` the server will accept")
+	maxReads := flag.Int("max-reads", 0, "drop entries set by this client after they're read `n` times, 0 for no limit")
+	lockAfter := flag.Duration("lock-after", 0, "make the server lock itself after it has been idle this long, once a PIN is set")
+	minLength := flag.Int("min-length", 0, "reject passwords shorter than `n` characters")
+	minStrength := flag.Float64("min-strength", 0, "reject passwords with an estimated strength below `bits`")
+	flag.StringVar(&output, "output", "text", "the output `format` for get and status (text or json)")
+	outFile := flag.String("out", "", "the `path` get-file and render write to instead of stdout")
+	mountPath := flag.String("path", "", "the `path` mount writes to, which must be under $XDG_RUNTIME_DIR/stash")
 	flag.IntVar(&port, "port", 2002, "The daemon will listen on this local port")
+	prompts := flag.StringSlice("prompt", nil, "ask for the values of these `fields` when setting an entry")
+	printGenerated := flag.Bool("print", false, "print the generated password once after setting it")
+	separator := flag.String("separator", "-", "the separator placed between the words of a generated passphrase")
+	revealPass := flag.Bool("reveal", false, "show the password on the alternate screen until a key is pressed")
+	revealTimeout := flag.Duration("reveal-timeout", time.Second*30, "clear a revealed password after this long, 0 to wait for a key press")
+	restoreClip := flag.Bool("restore-clipboard", false, "restore the clipboard (used internally by --clip)")
+	flag.CommandLine.MarkHidden("restore-clipboard")
+	reads := flag.Int("reads", 0, "stop the fifo after `n` readers, 0 for no limit")
+	removeOnExpiry := flag.Bool("remove-on-expiry", false, "remove the file render writes once its secrets expire")
+	require := flag.StringSlice("require", nil, "reject passwords missing any of these character `classes` (lower, upper, digit, symbol)")
 	set := flag.Bool("set", false, "set the password")
+	socket := flag.String("socket", "", "the `path` of the socket ssh-agent listens on")
+	status := flag.Bool("status", false, "report whether a password is set and when it expires")
+	stdin := flag.Bool("stdin", false, "read the password to set from stdin")
+	toStdin := flag.Bool("to-stdin", false, "make exec write the password to the command's stdin")
+	ttl := flag.Duration("ttl", 0, "drop entries set by this client after this long, 0 to use the server's expiration")
+	flag.DurationVar(&timeout, "timeout", time.Second*5, "how long the client will wait to connect to the server")
+	watch := flag.Bool("watch-expiry", false, "remove a rendered file on expiry (used internally by --remove-on-expiry)")
+	flag.CommandLine.MarkHidden("watch-expiry")
 	validate := flag.Bool("validate", false, "check whether a password is currently set")
 	flag.BoolVar(&verbose, "verbose", false, "enable debugging")
+	wordList := flag.String("word-list", client.DefaultWordList, "the `file` of words used for generated passphrases")
+	wipeOnSuspend := flag.Bool("wipe-on-suspend", false, "make the server drop everything when the system is resumed from suspend")
+	words := flag.Int("words", 0, "generate a passphrase of `n` words instead of a password")
 	flag.Parse()
 	setConfig()
 	prog := path.Base(os.Args[0])
 	if *help {
 		flag.Usage()
-		os.Exit(0)
+		os.Exit(exitOK)
+	}
+	if *restoreClip {
+		if err := restoreClipboard(); err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+		os.Exit(exitOK)
+	}
+	if *watch {
+		if err := watchExpiry(client.WithTLS(certFile), client.WithTimeout(timeout)); err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+		os.Exit(exitOK)
+	}
+	if output != "text" && output != "json" {
+		log.Fatalf("ERROR: unknown output format %q\n", output)
+	}
+	// Commands may also be given as the first argument, e.g. 'stash set'
+	args := flag.Args()
+	// Helpers for other tools can be installed as a symlink named after
+	// the program the tool expects
+	if command, ok := progCommands[prog]; ok {
+		args = append([]string{command}, args...)
+	} else if *askpassMode {
+		args = append([]string{"askpass"}, args...)
+	}
+	var command string
+	if len(args) > 0 {
+		command = args[0]
+	}
+	// get, set, status, generate and hold take an optional entry name
+	var name string
+	switch command {
+	case "get", "set", "status", "generate", "hold":
+		if len(args) > 1 {
+			name = args[1]
+		}
+	}
+	switch command {
+	case "get":
+		*get = true
+	case "set":
+		*set = true
+	case "status":
+		*status = true
+	case "generate":
+		*generate = true
+	}
+	source, err := passwordSource(*stdin, *fromFile, *fromEnv, *confirm)
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	policies, err := passwordPolicies(*minLength, *require, *minStrength)
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	var generated string
+	if *generate {
+		classes, err := parseClasses(*charset)
+		if err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+		generated, err = client.Generate(client.GenerateOptions{
+			Length:           *length,
+			Classes:          classes,
+			ExcludeAmbiguous: *excludeAmbiguous,
+			Words:            *words,
+			WordList:         *wordList,
+			Separator:        *separator,
+		})
+		if err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+		source = client.ValueSource([]byte(generated))
+	}
+	var expireHour, expireMinute int
+	if *expireAt != "" {
+		expireHour, expireMinute, err = parseClock(*expireAt)
+		if err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
 	}
 	if *asServer {
 		if *daemon {
-			binary, _ := exec.LookPath(os.Args[0])
-			args := []string{binary}
-			for _, arg := range os.Args[1:] {
-				if arg == "--daemon" {
-					continue
-				}
-				args = append(args, arg)
-			}
-			cmdEnv := os.Environ()
-			pid, err := syscall.ForkExec(binary, args, &syscall.ProcAttr{Env: cmdEnv})
+			pid, err := startDaemon()
 			if err != nil {
 				log.Fatalf("ERROR: unable to start %s in daemon mode: %v\n", prog, err)
 			}
@@ -110,31 +381,372 @@ func main() {
 		if err != nil {
 			log.Fatalf("Can't start server: %v\n", err)
 		}
-		s.Start()
+		s.SetMaxSize(*maxEntrySize)
+		if *expireAt != "" {
+			s.SetExpireAt(expireHour, expireMinute)
+		}
+		s.SetWipeOnSuspend(*wipeOnSuspend)
+		s.SetLockAfter(*lockAfter)
+		// Stopping the server removes any files entries were mounted to
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+		go func() {
+			sig := <-sigs
+			log.Debugf("Stopping the server on %s\n", sig)
+			s.Stop()
+		}()
+		if err := s.Start(); err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+		os.Exit(exitOK)
+	}
+	var setOpts []client.SetOption
+	if *ttl > 0 {
+		setOpts = append(setOpts, client.TTL(*ttl))
+	}
+	if *expireAt != "" {
+		setOpts = append(setOpts, client.ExpireAt(server.NextClock(time.Now(), expireHour, expireMinute)))
+	}
+	if *maxReads > 0 {
+		setOpts = append(setOpts, client.MaxReads(*maxReads))
+	}
+	if *bindParent {
+		*bindPID = os.Getppid()
+	}
+	if *bindPID > 0 {
+		setOpts = append(setOpts, client.BindPID(*bindPID))
 	}
 	if *asClient {
-		c, err := client.New(port, configFile, certFile)
+		addr := fmt.Sprintf("%s:%d", host, port)
+		opts := []client.Option{
+			client.WithConfig(configFile),
+			client.WithTLS(certFile),
+			client.WithTimeout(timeout),
+			client.WithPasswordSource(source),
+			client.WithPolicy(policies...),
+		}
+		if command == "askpass" {
+			// Fall back to asking the user when the server is down
+			var store secretStore
+			if c, err := client.New(addr, opts...); err == nil {
+				defer c.Close()
+				store = storeWithOptions{c, setOpts}
+			}
+			ask := func(prompt string, mask bool) ([]byte, error) {
+				return ttyPrompt("", prompt, mask)
+			}
+			err := askpass(context.Background(), store, strings.Join(args[1:], " "), os.Getppid(), ask, os.Stdout)
+			if err != nil {
+				log.Fatalf("ERROR: %v\n", err)
+			}
+			os.Exit(exitOK)
+		}
+		if command == "pinentry" {
+			// gpg-agent reads our stdout so logging must stay on stderr
+			p := &pinentry{ask: ttyPrompt}
+			if c, err := client.New(addr, opts...); err == nil {
+				defer c.Close()
+				p.store = storeWithOptions{c, setOpts}
+			}
+			if err := p.serve(context.Background(), os.Stdin, os.Stdout); err != nil {
+				log.Fatalf("ERROR: %v\n", err)
+			}
+			os.Exit(exitOK)
+		}
+		if command == "native-host" {
+			// The browser reads our stdout so logging must stay on stderr
+			n := &nativeHost{allowed: *allowOrigins}
+			c, err := client.New(addr, opts...)
+			if err == nil {
+				defer c.Close()
+				n.store = c
+			}
+			n.err = err
+			if err := n.serve(context.Background(), nativeOrigin(args[1:]), os.Stdin, os.Stdout); err != nil {
+				log.Fatalf("ERROR: %v\n", err)
+			}
+			os.Exit(exitOK)
+		}
+		c, err := client.New(addr, opts...)
 		if err != nil {
-			log.Fatalf("ERROR: %v\n", err)
+			fail(err)
+		}
+		defer c.Close()
+		ctx := context.Background()
+		switch command {
+		case "exec":
+			code, err := execCommand(ctx, c, args[1:], *env, *toStdin)
+			if err != nil {
+				fail(err)
+			}
+			os.Exit(code)
+		case "put-file":
+			if len(args) != 3 {
+				log.Fatalf("ERROR: usage: stash put-file NAME PATH\n")
+			}
+			if err := putFile(ctx, c, args[1], args[2], setOpts...); err != nil {
+				fail(err)
+			}
+			os.Exit(exitOK)
+		case "get-file":
+			if len(args) != 2 {
+				log.Fatalf("ERROR: usage: stash get-file NAME [--out PATH]\n")
+			}
+			if err := getFile(ctx, c, args[1], *outFile); err != nil {
+				fail(err)
+			}
+			os.Exit(exitOK)
+		case "encrypt", "decrypt":
+			if len(args) != 3 {
+				log.Fatalf("ERROR: usage: stash %s IN OUT\n", command)
+			}
+			passphrase, err := c.GetPassword(ctx)
+			if err != nil {
+				fail(err)
+			}
+			if err := cryptFile(command == "decrypt", []byte(passphrase), args[1], args[2]); err != nil {
+				fail(err)
+			}
+			os.Exit(exitOK)
+		case "mount":
+			if len(args) != 2 {
+				log.Fatalf("ERROR: usage: stash mount NAME [--path PATH] [--field FIELD]\n")
+			}
+			field := client.PasswordField
+			if len(*fields) > 0 {
+				field = (*fields)[0]
+			}
+			path := *mountPath
+			if path == "" {
+				path = defaultMountPath(args[1])
+			}
+			if err := c.Mount(ctx, args[1], field, path); err != nil {
+				fail(err)
+			}
+			warnIfNotTmpfs(path)
+			fmt.Println(path)
+			os.Exit(exitOK)
+		case "fifo":
+			if len(args) != 3 {
+				log.Fatalf("ERROR: usage: stash fifo NAME PATH [--reads N] [--field FIELD]\n")
+			}
+			name := args[1]
+			field := client.PasswordField
+			if len(*fields) > 0 {
+				field = (*fields)[0]
+			}
+			get := func() (string, error) {
+				return c.GetField(ctx, name, field)
+			}
+			check := func() error {
+				st, err := c.Status(ctx, name)
+				if err != nil {
+					return err
+				}
+				if !st.Set {
+					return &client.Error{Kind: client.KindNotSet, Err: fmt.Errorf("%s has expired", name)}
+				}
+				return nil
+			}
+			if err := serveFifo(args[2], *reads, get, check); err != nil {
+				fail(err)
+			}
+			os.Exit(exitOK)
+		case "render":
+			if len(args) != 2 {
+				log.Fatalf("ERROR: usage: stash render TEMPLATE [--out PATH]\n")
+			}
+			if err := renderFile(ctx, c, args[1], *outFile, *removeOnExpiry); err != nil {
+				fail(err)
+			}
+			os.Exit(exitOK)
+		case "hold":
+			pass, err := source()
+			if err != nil {
+				fail(err)
+			}
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			done, err := c.Hold(ctx, name, pass, setOpts...)
+			if err != nil {
+				fail(err)
+			}
+			held := name
+			if held == "" {
+				held = "the password"
+			}
+			log.Infof("Holding %s until interrupted\n", held)
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+			select {
+			case <-sigs:
+				cancel()
+				err = <-done
+			case err = <-done:
+			}
+			if err != nil {
+				fail(err)
+			}
+			os.Exit(exitOK)
+		case "pin", "lock", "unlock":
+			var pin []byte
+			// lock only needs a PIN if it's replacing the current one
+			if command != "lock" || *stdin {
+				pin, err = readPIN(*stdin, command == "pin")
+				if err != nil {
+					fail(err)
+				}
+			}
+			switch command {
+			case "pin":
+				err = c.SetPIN(ctx, pin)
+			case "lock":
+				err = c.Lock(ctx, pin)
+			case "unlock":
+				err = c.Unlock(ctx, pin)
+			}
+			if err != nil {
+				fail(err)
+			}
+			os.Exit(exitOK)
+		case "ssh-add":
+			if len(args) < 2 {
+				log.Fatalf("ERROR: usage: stash ssh-add PATH...\n")
+			}
+			// The agent reads every key for each request
+			if *maxReads > 0 {
+				log.Fatalf("ERROR: --max-reads can't be used with ssh-add\n")
+			}
+			ask := func(prompt string, mask bool) ([]byte, error) {
+				return ttyPrompt("", prompt, mask)
+			}
+			for _, path := range args[1:] {
+				if err := sshAdd(ctx, c, path, ask, setOpts...); err != nil {
+					fail(err)
+				}
+			}
+			os.Exit(exitOK)
+		case "ssh-agent":
+			if *daemon {
+				if err := startAgent(*socket); err != nil {
+					fail(err)
+				}
+				os.Exit(exitOK)
+			}
+			if err := serveAgent(ctx, c, *socket); err != nil {
+				fail(err)
+			}
+			os.Exit(exitOK)
+		case "credential-git":
+			if len(args) != 2 {
+				log.Fatalf("ERROR: usage: stash credential-git get|store|erase\n")
+			}
+			store := storeWithOptions{c, setOpts}
+			if err := gitCredential(ctx, store, args[1], os.Stdin, os.Stdout); err != nil {
+				fail(err)
+			}
+			os.Exit(exitOK)
+		case "credential-docker":
+			if len(args) != 2 {
+				log.Fatalf("ERROR: usage: stash credential-docker get|store|erase|list\n")
+			}
+			store := storeWithOptions{c, setOpts}
+			if err := dockerCredentialHelper(ctx, store, args[1], os.Stdin, os.Stdout); err != nil {
+				// Docker reads errors from stdout
+				fmt.Println(err)
+				os.Exit(exitCode(err))
+			}
+			os.Exit(exitOK)
+		}
+		if *get && *format != "" {
+			// Credentials for other tools are made from several fields
+			values, err := c.GetFields(ctx, name)
+			if err != nil {
+				fail(err)
+			}
+			st, err := c.Status(ctx, name)
+			if err != nil {
+				fail(err)
+			}
+			data, err := formatCredential(*format, values, st.Expires)
+			if err != nil {
+				fail(err)
+			}
+			fmt.Println(string(data))
+			os.Exit(exitOK)
 		}
 		if *get {
-			out, err := c.GetPassword()
+			field := client.PasswordField
+			switch len(*fields) {
+			case 0:
+			case 1:
+				field = (*fields)[0]
+			default:
+				log.Fatalf("ERROR: only one --field may be given to get\n")
+			}
+			out, err := c.GetField(ctx, name, field)
 			if err != nil {
-				if *validate {
-					if strings.Contains(err.Error(), "not set") {
-						fmt.Println("Password not set")
-						os.Exit(99)
-					}
+				if *validate && output == "text" && client.ErrorKind(err) == client.KindNotSet {
+					fmt.Println("Password not set")
+					os.Exit(exitNotSet)
 				}
-				log.Fatalf("ERROR: %v\n", err)
+				fail(err)
+			}
+			switch {
+			case *clip:
+				if err := copyToClipboard(out, *clipCommand, *clipTimeout); err != nil {
+					fail(err)
+				}
+				if *clipTimeout > 0 {
+					fmt.Printf("Copied password to the clipboard, it will be cleared in %d seconds\n", *clipTimeout)
+				}
+			case output == "json":
+				printJSON(map[string]string{field: out})
+			case *revealPass:
+				if err := reveal(out, *revealTimeout); err != nil {
+					fail(err)
+				}
+			default:
+				obscure(out)
 			}
-			obscure(out)
 		}
-		if *set {
-			err := c.SetPassword()
+		if (*set || *generate) && (len(*fields) > 0 || len(*prompts) > 0) {
+			values, err := entryFields(*fields, *prompts, func(prompt string, mask bool) ([]byte, error) {
+				return ttyPrompt("", prompt, mask)
+			})
 			if err != nil {
 				log.Fatalf("ERROR: %v\n", err)
 			}
+			// The password only comes from the usual sources when one was
+			// asked for explicitly
+			if *generate || *stdin || *fromFile != "" || *fromEnv != "" {
+				pass, err := source()
+				if err != nil {
+					fail(err)
+				}
+				values[client.PasswordField] = pass
+			}
+			if err := c.SetFields(ctx, name, values, setOpts...); err != nil {
+				fail(err)
+			}
+		} else if *set || *generate {
+			err := c.SetFromSource(ctx, name, setOpts...)
+			if err != nil {
+				fail(err)
+			}
+		}
+		if *generate && *printGenerated {
+			obscure(generated)
+		}
+		if *status {
+			st, err := c.Status(ctx, name)
+			if err != nil {
+				fail(err)
+			}
+			printStatus(st)
+			if !st.Set {
+				os.Exit(exitNotSet)
+			}
 		}
 	}
 }
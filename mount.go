@@ -0,0 +1,18 @@
+package main
+
+import (
+	"net/url"
+	"path/filepath"
+
+	"github.com/walkert/stash/server"
+)
+
+// defaultMountPath returns where the entry called name is mounted when no
+// --path is given, inside the server's mount directory.
+func defaultMountPath(name string) string {
+	if name == "" {
+		name = "default"
+	}
+	// Entry names such as git:https://example.com contain slashes
+	return filepath.Join(server.DefaultMountDir(), url.PathEscape(name))
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/walkert/stash/client"
+)
+
+// maxNativeMessage is the largest message accepted from the browser. Chrome
+// allows 4GB but a request for a secret is tiny.
+const maxNativeMessage = 1024 * 1024
+
+// nativeRequest is a message sent by a browser extension.
+type nativeRequest struct {
+	Action string `json:"action"`
+	Name   string `json:"name"`
+}
+
+// nativeResponse is the reply to a nativeRequest. Errors carry the exit code
+// the command line client would have used so extensions can tell an empty
+// stash apart from other failures.
+type nativeResponse struct {
+	Password string   `json:"password,omitempty"`
+	Names    []string `json:"names,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Code     int      `json:"code,omitempty"`
+}
+
+// nativeHost serves the Chrome and Firefox native messaging protocol. store
+// may be nil if the server couldn't be reached, in which case err says why.
+type nativeHost struct {
+	allowed []string
+	err     error
+	store   secretStore
+}
+
+// nativeOrigin returns the extension the browser started us for. Chrome
+// passes the extension's origin while Firefox passes the path to the host's
+// manifest followed by the extension's ID.
+func nativeOrigin(args []string) string {
+	if len(args) > 1 && strings.HasSuffix(args[0], ".json") {
+		return args[1]
+	}
+	if len(args) > 0 {
+		return args[0]
+	}
+	return ""
+}
+
+// readNativeMessage reads a message prefixed by its length. Browsers use
+// native byte order, which is little endian on every platform stash runs on.
+func readNativeMessage(r io.Reader, v interface{}) error {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return err
+	}
+	if size > maxNativeMessage {
+		return fmt.Errorf("message of %d bytes is too large", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return fmt.Errorf("unable to read message: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid message: %v", err)
+	}
+	return nil
+}
+
+func writeNativeMessage(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func nativeError(err error) nativeResponse {
+	return nativeResponse{Error: strings.TrimSpace(err.Error()), Code: exitCode(err)}
+}
+
+func (n *nativeHost) handle(ctx context.Context, req nativeRequest) nativeResponse {
+	if n.store == nil {
+		return nativeError(n.err)
+	}
+	switch req.Action {
+	case "get":
+		password, err := n.store.Get(ctx, req.Name)
+		if err != nil {
+			return nativeError(err)
+		}
+		return nativeResponse{Password: password}
+	case "list":
+		names, err := n.store.List(ctx)
+		if err != nil {
+			return nativeError(err)
+		}
+		return nativeResponse{Names: names}
+	}
+	return nativeError(fmt.Errorf("unknown action %q", req.Action))
+}
+
+// serve answers requests from origin until the browser closes stdin.
+// Extensions which aren't allowed get a single error in reply.
+func (n *nativeHost) serve(ctx context.Context, origin string, r io.Reader, w io.Writer) error {
+	allowed := false
+	for _, o := range n.allowed {
+		if o == origin {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		err := &client.Error{Kind: client.KindAuth, Err: fmt.Errorf("extension %q is not allowed", origin)}
+		writeNativeMessage(w, nativeError(err))
+		return err
+	}
+	for {
+		var req nativeRequest
+		if err := readNativeMessage(r, &req); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := writeNativeMessage(w, n.handle(ctx, req)); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestNativeHost(t *testing.T) {
+	origin := "chrome-extension://abcdefg/"
+	n := &nativeHost{allowed: []string{origin}, store: fakeStore{"site": "secret"}}
+	var in, out bytes.Buffer
+	for _, req := range []nativeRequest{{Action: "get", Name: "site"}, {Action: "get", Name: "missing"}, {Action: "list"}} {
+		writeNativeMessage(&in, req)
+	}
+	if err := n.serve(context.Background(), origin, &in, &out); err != nil {
+		t.Fatalf("unexpected error serving requests: %v\n", err)
+	}
+	want := []nativeResponse{
+		{Password: "secret"},
+		{Error: "missing not set", Code: exitNotSet},
+		{Names: []string{"site"}},
+	}
+	for _, w := range want {
+		var got nativeResponse
+		if err := readNativeMessage(&out, &got); err != nil {
+			t.Fatalf("unable to read response: %v\n", err)
+		}
+		if !reflect.DeepEqual(got, w) {
+			t.Fatalf("Wanted: %+v, got: %+v\n", w, got)
+		}
+	}
+	out.Reset()
+	if err := n.serve(context.Background(), "chrome-extension://other/", &in, &out); err == nil {
+		t.Fatalf("expected an error for an unknown extension but got none")
+	}
+	var got nativeResponse
+	if err := readNativeMessage(&out, &got); err != nil || got.Code != exitAuth {
+		t.Fatalf("expected an auth error response, got: %+v (%v)\n", got, err)
+	}
+	n = &nativeHost{allowed: []string{origin}, err: fmt.Errorf("server unavailable")}
+	writeNativeMessage(&in, nativeRequest{Action: "get"})
+	out.Reset()
+	n.serve(context.Background(), origin, &in, &out)
+	if err := readNativeMessage(&out, &got); err != nil || got.Error != "server unavailable" {
+		t.Fatalf("expected an unavailable error response, got: %+v (%v)\n", got, err)
+	}
+	if o := nativeOrigin([]string{"/path/to/stash.json", "stash@example.com"}); o != "stash@example.com" {
+		t.Fatalf("Wanted the Firefox extension ID, got: %s\n", o)
+	}
+}
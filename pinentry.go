@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/walkert/stash/client"
+)
+
+// Assuan error codes returned to gpg-agent. These are GPG_ERR_CANCELED and
+// GPG_ERR_NOT_CONFIRMED with the pinentry error source.
+const (
+	assuanCanceled     = 83886179
+	assuanNotConfirmed = 83886194
+)
+
+// pinentry implements enough of the Assuan pinentry protocol for gpg-agent.
+// PINs are answered from the stash using an entry named after the key and
+// are stashed when the user has to be asked.
+type pinentry struct {
+	ask   func(tty, prompt string, mask bool) ([]byte, error)
+	store secretStore
+	tty   string
+
+	desc    string
+	err     string
+	genPin  bool
+	keyinfo string
+	prompt  string
+	// repeat is set when the PIN must be entered twice, which gpg-agent asks
+	// for when a new passphrase is being chosen
+	repeat       bool
+	repeatErr    string
+	repeatPrompt string
+}
+
+// maxRepeats is how many times a new PIN may be mistyped before GETPIN is
+// cancelled.
+const maxRepeats = 3
+
+// assuanDecode reverses the percent escaping used for Assuan parameters.
+func assuanDecode(s string) string {
+	decoded, err := url.PathUnescape(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
+
+// assuanEncode escapes the characters which can't appear in a data line.
+func assuanEncode(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func (p *pinentry) reset() {
+	p.desc, p.err, p.keyinfo, p.prompt = "", "", "", ""
+	p.clearRepeat()
+}
+
+// clearRepeat forgets the settings for a new PIN, which like the error only
+// apply to the next GETPIN.
+func (p *pinentry) clearRepeat() {
+	p.genPin, p.repeat, p.repeatErr, p.repeatPrompt = false, false, "", ""
+}
+
+func (p *pinentry) entryName() string {
+	if p.keyinfo == "" {
+		return "pinentry"
+	}
+	return "pinentry:" + p.keyinfo
+}
+
+// text returns what the user should see before being asked for input.
+func (p *pinentry) text(fallback string) string {
+	var parts []string
+	for _, s := range []string{p.err, p.desc} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	prompt := p.prompt
+	if prompt == "" {
+		prompt = fallback
+	}
+	if !strings.HasSuffix(prompt, " ") {
+		prompt += " "
+	}
+	return strings.Join(append(parts, prompt), "\n")
+}
+
+// getPin returns the PIN and whether it was entered twice as requested by
+// SETREPEAT.
+func (p *pinentry) getPin(ctx context.Context) (string, bool, error) {
+	name := p.entryName()
+	// A new PIN is being chosen so it has to come from the user
+	if p.repeat || p.genPin {
+		pin, err := p.askNew()
+		if err != nil {
+			return "", false, err
+		}
+		p.stash(ctx, name, pin)
+		return string(pin), p.repeat, nil
+	}
+	// gpg-agent sets an error when the last PIN was wrong, in which case the
+	// stashed one can't be trusted
+	if p.store != nil && p.err == "" {
+		pin, err := p.store.Get(ctx, name)
+		if err == nil {
+			return pin, false, nil
+		}
+		if client.ErrorKind(err) != client.KindNotSet {
+			log.Debugf("Unable to get stashed PIN: %v\n", err)
+		}
+	}
+	pin, err := p.ask(p.tty, p.text("PIN:"), true)
+	if err != nil {
+		return "", false, err
+	}
+	p.stash(ctx, name, pin)
+	return string(pin), false, nil
+}
+
+// askNew asks for a new PIN twice, asking again until both answers match.
+func (p *pinentry) askNew() ([]byte, error) {
+	repeatPrompt := p.repeatPrompt
+	if repeatPrompt == "" {
+		repeatPrompt = "Repeat:"
+	}
+	for i := 0; i < maxRepeats; i++ {
+		pin, err := p.ask(p.tty, p.text("PIN:"), true)
+		if err != nil {
+			return nil, err
+		}
+		again, err := p.ask(p.tty, repeatPrompt+" ", true)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(pin, again) {
+			return pin, nil
+		}
+		p.err = p.repeatErr
+		if p.err == "" {
+			p.err = "The PINs don't match"
+		}
+	}
+	return nil, fmt.Errorf("the PINs didn't match")
+}
+
+// stash stores a PIN the user typed so they aren't asked for it again.
+func (p *pinentry) stash(ctx context.Context, name string, pin []byte) {
+	if p.store == nil || len(pin) == 0 {
+		return
+	}
+	if err := p.store.Set(ctx, name, pin); err != nil {
+		log.Debugf("Unable to stash PIN: %v\n", err)
+	}
+}
+
+func (p *pinentry) confirm(oneButton bool) bool {
+	if oneButton {
+		p.ask(p.tty, p.text("Press enter to continue"), false)
+		return true
+	}
+	answer, err := p.ask(p.tty, p.text("[y/N]"), false)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(strings.ToLower(string(answer)), "y")
+}
+
+// serve reads commands from r and writes responses to w until BYE or EOF.
+func (p *pinentry) serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	ok := func() { fmt.Fprintln(w, "OK") }
+	fmt.Fprintln(w, "OK Pleased to meet you")
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		spl := strings.SplitN(scanner.Text(), " ", 2)
+		command := strings.ToUpper(spl[0])
+		var arg string
+		if len(spl) == 2 {
+			arg = assuanDecode(spl[1])
+		}
+		switch command {
+		case "SETDESC":
+			p.desc = arg
+			ok()
+		case "SETPROMPT":
+			p.prompt = arg
+			ok()
+		case "SETERROR":
+			p.err = arg
+			ok()
+		case "SETREPEAT":
+			p.repeat = true
+			p.repeatPrompt = arg
+			ok()
+		case "SETREPEATERROR":
+			p.repeatErr = arg
+			ok()
+		case "SETGENPIN":
+			p.genPin = true
+			ok()
+		case "SETKEYINFO":
+			if arg != "--clear" {
+				p.keyinfo = arg
+			}
+			ok()
+		case "OPTION":
+			if strings.HasPrefix(arg, "ttyname=") {
+				p.tty = strings.TrimPrefix(arg, "ttyname=")
+			}
+			ok()
+		case "GETINFO":
+			switch arg {
+			case "flavor":
+				fmt.Fprintln(w, "D stash")
+			case "version":
+				fmt.Fprintln(w, "D 1.0.0")
+			case "pid":
+				fmt.Fprintf(w, "D %d\n", os.Getpid())
+			}
+			ok()
+		case "GETPIN":
+			pin, repeated, err := p.getPin(ctx)
+			p.err = ""
+			p.clearRepeat()
+			if err != nil {
+				log.Debugf("Unable to get PIN: %v\n", err)
+				fmt.Fprintf(w, "ERR %d Operation cancelled <Pinentry>\n", assuanCanceled)
+				continue
+			}
+			if repeated {
+				fmt.Fprintln(w, "S PIN_REPEATED")
+			}
+			if pin != "" {
+				fmt.Fprintf(w, "D %s\n", assuanEncode(pin))
+			}
+			ok()
+		case "CONFIRM", "MESSAGE":
+			if p.confirm(command == "MESSAGE" || arg == "--one-button") {
+				ok()
+			} else {
+				fmt.Fprintf(w, "ERR %d Not confirmed <Pinentry>\n", assuanNotConfirmed)
+			}
+		case "RESET":
+			p.reset()
+			ok()
+		case "BYE":
+			ok()
+			return nil
+		default:
+			// Titles, button labels, timeouts and so on don't apply to a
+			// terminal prompt
+			ok()
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPinentry(t *testing.T) {
+	var prompts []string
+	ask := func(tty, prompt string, mask bool) ([]byte, error) {
+		prompts = append(prompts, prompt)
+		return []byte("typed%pin"), nil
+	}
+	store := fakeStore{}
+	p := &pinentry{ask: ask, store: store}
+	in := strings.Join([]string{
+		"OPTION ttyname=/dev/pts/1",
+		"SETDESC Please enter the passphrase%0Afor key ABC",
+		"SETPROMPT Passphrase:",
+		"SETKEYINFO n/ABC",
+		"GETPIN",
+		"GETPIN",
+		"SETERROR Bad Passphrase",
+		"GETPIN",
+		"BYE",
+	}, "\n")
+	var out bytes.Buffer
+	if err := p.serve(context.Background(), strings.NewReader(in), &out); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	want := strings.Join([]string{
+		"OK Pleased to meet you",
+		"OK",
+		"OK",
+		"OK",
+		"OK",
+		"D typed%25pin",
+		"OK",
+		"D typed%25pin",
+		"OK",
+		"OK",
+		"D typed%25pin",
+		"OK",
+		"OK",
+	}, "\n") + "\n"
+	if out.String() != want {
+		t.Fatalf("Wanted:\n%s\ngot:\n%s\n", want, out.String())
+	}
+	if len(prompts) != 2 {
+		t.Fatalf("expected to be asked twice, got: %v\n", prompts)
+	}
+	if prompts[0] != "Please enter the passphrase\nfor key ABC\nPassphrase: " {
+		t.Fatalf("unexpected prompt: %q\n", prompts[0])
+	}
+	if !strings.HasPrefix(prompts[1], "Bad Passphrase\n") {
+		t.Fatalf("expected error in prompt, got: %q\n", prompts[1])
+	}
+	if store["pinentry:n/ABC"] != "typed%pin" {
+		t.Fatalf("expected PIN to be stashed, got: %v\n", store)
+	}
+	if p.tty != "/dev/pts/1" {
+		t.Fatalf("Wanted tty '/dev/pts/1', got: %s\n", p.tty)
+	}
+}
+
+func TestPinentryRepeat(t *testing.T) {
+	answers := []string{"new", "typo", "new", "new"}
+	var prompts []string
+	ask := func(tty, prompt string, mask bool) ([]byte, error) {
+		prompts = append(prompts, prompt)
+		answer := answers[0]
+		answers = answers[1:]
+		return []byte(answer), nil
+	}
+	// A new passphrase is never answered from the stash
+	store := fakeStore{"pinentry": "cached"}
+	p := &pinentry{ask: ask, store: store}
+	in := strings.Join([]string{
+		"SETPROMPT Passphrase:",
+		"SETREPEAT Repeat:",
+		"SETREPEATERROR does not match",
+		"GETPIN",
+		"GETPIN",
+		"BYE",
+	}, "\n")
+	var out bytes.Buffer
+	if err := p.serve(context.Background(), strings.NewReader(in), &out); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	want := strings.Join([]string{
+		"OK Pleased to meet you",
+		"OK",
+		"OK",
+		"OK",
+		"S PIN_REPEATED",
+		"D new",
+		"OK",
+		// SETREPEAT only applies to one GETPIN
+		"D new",
+		"OK",
+		"OK",
+	}, "\n") + "\n"
+	if out.String() != want {
+		t.Fatalf("Wanted:\n%s\ngot:\n%s\n", want, out.String())
+	}
+	if len(prompts) != 4 || !strings.HasPrefix(prompts[2], "does not match\n") {
+		t.Fatalf("expected to be asked again after a mismatch, got: %q\n", prompts)
+	}
+	if store["pinentry"] != "new" {
+		t.Fatalf("expected the new PIN to be stashed, got: %v\n", store)
+	}
+	// SETGENPIN also means a new PIN
+	answers = []string{"a", "b", "c", "d", "e", "f"}
+	out.Reset()
+	in = "SETGENPIN Generate\nGETPIN\nBYE"
+	if err := p.serve(context.Background(), strings.NewReader(in), &out); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if !strings.Contains(out.String(), "ERR ") {
+		t.Fatalf("expected GETPIN to be cancelled after %d mismatches, got: %s\n", maxRepeats, out.String())
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/walkert/stash/client"
+)
+
+// stashRef matches the secret references render expands: the action
+// {{ stash "name" "field" }}, whose field is optional, or stash://name#field.
+// Nothing else in a template is interpreted.
+var stashRef = regexp.MustCompile(`\{\{-?\s*stash\s[^}]*\}\}|stash://([^\s#"'<>]+)(?:#([\w.-]+))?`)
+
+// stashAction parses the arguments of a stash action, which must be quoted
+// strings as in a Go template.
+var stashAction = regexp.MustCompile(`^\{\{\s*stash\s+("(?:[^"\\]|\\.)*")(?:\s+("(?:[^"\\]|\\.)*"))?\s*\}\}$`)
+
+// tmpfsMagic is the filesystem type statfs reports for tmpfs.
+const tmpfsMagic = 0x01021994
+
+// warnIfNotTmpfs warns when the file at path would be written to a disk
+// rather than kept in memory.
+func warnIfNotTmpfs(path string) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(filepath.Dir(path), &fs); err == nil && fs.Type != tmpfsMagic {
+		log.Warnf("%s isn't on tmpfs so the secret may be written to disk\n", path)
+	}
+}
+
+// renderTemplate replaces the secret references in text with values from
+// the entries returned by get. Only references are expanded, so any other
+// {{ }} actions are left as they are for whatever reads the output. Each
+// entry is only fetched once however often it's referenced, since every
+// fetch counts against an entry's --max-reads. It returns the rendered text
+// and the names of the entries it used.
+func renderTemplate(text string, get func(name string) (map[string]string, error)) ([]byte, []string, error) {
+	var names []string
+	entries := map[string]map[string]string{}
+	lookup := func(name, field string) (string, error) {
+		fields, ok := entries[name]
+		if !ok {
+			var err error
+			if fields, err = get(name); err != nil {
+				return "", err
+			}
+			entries[name] = fields
+			names = append(names, name)
+		}
+		value, ok := fields[field]
+		if !ok {
+			return "", &client.Error{Kind: client.KindNotSet, Err: fmt.Errorf("%s has no %s field", name, field)}
+		}
+		return value, nil
+	}
+	var out bytes.Buffer
+	last := 0
+	// Values are written straight to the output so they're never scanned
+	// for references themselves
+	for _, loc := range stashRef.FindAllStringSubmatchIndex(text, -1) {
+		out.WriteString(text[last:loc[0]])
+		last = loc[1]
+		ref := text[loc[0]:loc[1]]
+		name, field := "", client.PasswordField
+		if loc[2] >= 0 {
+			name = text[loc[2]:loc[3]]
+			if loc[4] >= 0 {
+				field = text[loc[4]:loc[5]]
+			}
+		} else {
+			var err error
+			m := stashAction.FindStringSubmatch(ref)
+			if m != nil {
+				name, err = strconv.Unquote(m[1])
+				if err == nil && m[2] != "" {
+					field, err = strconv.Unquote(m[2])
+				}
+			}
+			if m == nil || err != nil {
+				return nil, nil, fmt.Errorf("invalid template: %s should be {{ stash \"name\" }} or {{ stash \"name\" \"field\" }}", ref)
+			}
+		}
+		value, err := lookup(name, field)
+		if err != nil {
+			return nil, nil, err
+		}
+		out.WriteString(value)
+	}
+	out.WriteString(text[last:])
+	return out.Bytes(), names, nil
+}
+
+// expiryState is passed to the background process that removes a rendered
+// file once the secrets in it expire.
+type expiryState struct {
+	Path    string    `json:"path"`
+	Entries []string  `json:"entries"`
+	Expires time.Time `json:"expires"`
+}
+
+// renderFile renders the template at path to out, or stdout if out is
+// empty. With removeOnExpiry the output is deleted by a background process
+// once any of the secrets it contains expire, are dropped by the server or
+// are locked.
+func renderFile(ctx context.Context, c *client.Client, path, out string, removeOnExpiry bool) error {
+	text, err := readInput(path)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	data, names, err := renderTemplate(string(text), func(name string) (map[string]string, error) {
+		return c.GetFields(ctx, name)
+	})
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		out = "-"
+	}
+	if removeOnExpiry {
+		if out == "-" {
+			return fmt.Errorf("--remove-on-expiry needs --out")
+		}
+		warnIfNotTmpfs(out)
+	}
+	if err := writeOutput(out, data); err != nil {
+		return err
+	}
+	if !removeOnExpiry || len(names) == 0 {
+		return nil
+	}
+	// The background process may not share our working directory
+	abs, err := filepath.Abs(out)
+	if err != nil {
+		return err
+	}
+	state := expiryState{Path: abs, Entries: names}
+	for _, name := range names {
+		st, err := c.Status(ctx, name)
+		if err != nil {
+			return err
+		}
+		if !st.Expires.IsZero() && (state.Expires.IsZero() || st.Expires.Before(state.Expires)) {
+			state.Expires = st.Expires
+		}
+	}
+	return startExpiryWatch(state)
+}
+
+// startExpiryWatch starts a background process to remove state.Path.
+func startExpiryWatch(state expiryState) error {
+	return startBackground("expiry watch", state, "--watch-expiry",
+		"--host", host,
+		"--port", strconv.Itoa(port),
+		"--cert-file", certFile,
+	)
+}
+
+// watchExpiry runs in the background process started by startExpiryWatch.
+// It checks on the entries as often as the server's watchdog runs and
+// removes the file as soon as any of them are gone or the stash is locked,
+// including when the server itself can't be reached.
+func watchExpiry(opts ...client.Option) error {
+	var state expiryState
+	if err := readBackgroundState("expiry", &state); err != nil {
+		return err
+	}
+	defer os.Remove(state.Path)
+	c, err := client.New(fmt.Sprintf("%s:%d", host, port), opts...)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	ticker := time.NewTicker(time.Second * 5)
+	defer ticker.Stop()
+	for {
+		if !state.Expires.IsZero() && !time.Now().Before(state.Expires) {
+			return nil
+		}
+		if _, err := os.Stat(state.Path); err != nil {
+			return nil
+		}
+		for _, name := range state.Entries {
+			st, err := c.Status(context.Background(), name)
+			if err != nil || !st.Set || st.Locked {
+				return nil
+			}
+		}
+		<-ticker.C
+	}
+}
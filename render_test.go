@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	secrets := map[string]map[string]string{
+		"db":            {"password": "p{{w}}", "user": "alice"},
+		"git:https://h": {"password": "token"},
+	}
+	fetched := map[string]int{}
+	get := func(name string) (map[string]string, error) {
+		fields, ok := secrets[name]
+		if !ok {
+			return nil, fmt.Errorf("%s not set", name)
+		}
+		fetched[name]++
+		return fields, nil
+	}
+	text := `user={{ stash "db" "user" }} pass=stash://db url=stash://git:https://h#password`
+	out, names, err := renderTemplate(text, get)
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %v\n", err)
+	}
+	// Secret values are never treated as template actions
+	want := "user=alice pass=p{{w}} url=token"
+	if string(out) != want {
+		t.Fatalf("Wanted: '%s', got: %s\n", want, out)
+	}
+	if !reflect.DeepEqual(names, []string{"db", "git:https://h"}) {
+		t.Fatalf("unexpected entries used: %q\n", names)
+	}
+	// Every fetch counts against --max-reads so each entry is fetched once
+	if fetched["db"] != 1 {
+		t.Fatalf("Wanted db to be fetched once, got: %d\n", fetched["db"])
+	}
+	if _, _, err := renderTemplate("stash://db#missing", get); err == nil {
+		t.Fatalf("expected error rendering a missing field but got none")
+	}
+	if _, _, err := renderTemplate("stash://missing", get); err == nil {
+		t.Fatalf("expected error rendering a missing secret but got none")
+	}
+	// Anything other than a reference is left alone, including template
+	// actions meant for another tool
+	text = `{{ .Values.port }} {{ env "HOME" }} {{stash "db" "user"}}`
+	out, _, err = renderTemplate(text, get)
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %v\n", err)
+	}
+	want = `{{ .Values.port }} {{ env "HOME" }} alice`
+	if string(out) != want {
+		t.Fatalf("Wanted: '%s', got: %s\n", want, out)
+	}
+	for _, text := range []string{`{{ stash db }}`, `{{ stash "db" | printf "%s" }}`, `{{ stash "db" "user" "x" }}`, `{{- stash "db" }}`} {
+		if _, _, err := renderTemplate(text, get); err == nil {
+			t.Fatalf("expected error rendering %s but got none\n", text)
+		}
+	}
+}
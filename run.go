@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/walkert/stash/client"
+)
+
+// forwardSignals are passed on to the child started by execCommand.
+var forwardSignals = []os.Signal{
+	syscall.SIGHUP,
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGTERM,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+	syscall.SIGWINCH,
+}
+
+// execCommand fetches the password and runs args with it set in the
+// environment variable env and/or written to the command's stdin. The
+// password is never printed. It returns the exit code of the command.
+func execCommand(ctx context.Context, c *client.Client, args []string, env string, toStdin bool) (int, error) {
+	if len(args) == 0 {
+		return exitError, fmt.Errorf("usage: stash exec --env VAR -- command [args...]")
+	}
+	if env == "" && !toStdin {
+		return exitError, fmt.Errorf("one of --env or --to-stdin is required")
+	}
+	password, err := c.GetPassword(ctx)
+	if err != nil {
+		return exitError, err
+	}
+	return runWithSecret(password, args, env, toStdin)
+}
+
+func runWithSecret(secret string, args []string, env string, toStdin bool) (int, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if env != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", env, secret))
+	}
+	if toStdin {
+		cmd.Stdin = strings.NewReader(secret + "\n")
+	} else {
+		cmd.Stdin = os.Stdin
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardSignals...)
+	defer signal.Stop(sigs)
+	if err := cmd.Start(); err != nil {
+		return exitError, fmt.Errorf("unable to start %s: %v", args[0], err)
+	}
+	go func() {
+		for sig := range sigs {
+			cmd.Process.Signal(sig)
+		}
+	}()
+	err := cmd.Wait()
+	if err == nil {
+		return exitOK, nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			// Follow the shell convention for commands killed by a signal
+			if status.Signaled() {
+				return 128 + int(status.Signal()), nil
+			}
+			return status.ExitStatus(), nil
+		}
+	}
+	return exitError, fmt.Errorf("unable to run %s: %v", args[0], err)
+}
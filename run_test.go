@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunWithSecret(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	tests := []struct {
+		name    string
+		script  string
+		env     string
+		toStdin bool
+		code    int
+		want    string
+	}{
+		{"env", `printf %s "$SECRET" > "$OUT"`, "SECRET", false, exitOK, "secret"},
+		{"stdin", `cat > "$OUT"`, "", true, exitOK, "secret\n"},
+		{"both", `read line; printf %s-%s "$SECRET" "$line" > "$OUT"`, "SECRET", true, exitOK, "secret-secret"},
+		{"exit code", `exit 7`, "SECRET", false, 7, ""},
+		{"killed", `kill -TERM $$`, "SECRET", false, 128 + int(syscall.SIGTERM), ""},
+	}
+	os.Setenv("OUT", out)
+	defer os.Unsetenv("OUT")
+	for _, tt := range tests {
+		os.Remove(out)
+		code, err := runWithSecret("secret", []string{"sh", "-c", tt.script}, tt.env, tt.toStdin)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v\n", tt.name, err)
+		}
+		if code != tt.code {
+			t.Fatalf("%s: Wanted exit code %d, got: %d\n", tt.name, tt.code, code)
+		}
+		if tt.want == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(out)
+		if err != nil || string(data) != tt.want {
+			t.Fatalf("%s: Wanted: %q, got: %q (%v)\n", tt.name, tt.want, data, err)
+		}
+	}
+	if _, err := runWithSecret("secret", []string{filepath.Join(dir, "missing")}, "SECRET", false); err == nil {
+		t.Fatalf("expected an error running a missing command but got none")
+	}
+}
+
+func TestRunWithSecretSignals(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	ready := filepath.Join(dir, "ready")
+	script := `trap 'exit 3' USR1; touch "$0"; while :; do sleep 0.05; done`
+	go func() {
+		// Signal ourselves once the child is ready, as a terminal would
+		for deadline := time.Now().Add(time.Second * 5); time.Now().Before(deadline); time.Sleep(time.Millisecond * 10) {
+			if _, err := os.Stat(ready); err == nil {
+				syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+				return
+			}
+		}
+	}()
+	code, err := runWithSecret("secret", []string{"sh", "-c", script, ready}, "SECRET", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if code != 3 {
+		t.Fatalf("Wanted the child to exit with 3 after SIGUSR1, got: %d\n", code)
+	}
+}
+
+func TestExecCommandUsage(t *testing.T) {
+	ctx := context.Background()
+	if _, err := execCommand(ctx, nil, nil, "SECRET", false); err == nil {
+		t.Fatalf("expected an error without a command but got none")
+	}
+	if _, err := execCommand(ctx, nil, []string{"true"}, "", false); err == nil {
+		t.Fatalf("expected an error without --env or --to-stdin but got none")
+	}
+}
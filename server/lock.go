@@ -0,0 +1,229 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	gocipher "crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	pb "github.com/walkert/stash/stashproto"
+	"golang.org/x/crypto/scrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+)
+
+// maxUnlockAttempts is how many wrong PINs are accepted before every entry
+// is dropped. PINs are short so they mustn't be open to guessing.
+const maxUnlockAttempts = 5
+
+// pinCheck is sealed with the PIN key so a PIN can be checked even when
+// there are no entries.
+var pinCheck = []byte("stash")
+
+func errLocked() error {
+	return grpc.Errorf(codes.FailedPrecondition, "the stash is locked")
+}
+
+// newPinKey derives the key entries are sealed with while the vault is
+// locked.
+func newPinKey(pin, salt []byte) (gocipher.AEAD, error) {
+	key, err := scrypt.Key(pin, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "unable to derive key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "unable to derive key: %v", err)
+	}
+	return gocipher.NewGCM(block)
+}
+
+// seal encrypts data with key, prefixing it with the nonce used.
+func seal(key gocipher.AEAD, data []byte) ([]byte, error) {
+	nonce := make([]byte, key.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, grpc.Errorf(codes.Internal, "unable to generate nonce: %v", err)
+	}
+	return key.Seal(nonce, nonce, data, nil), nil
+}
+
+// unseal reverses seal.
+func unseal(key gocipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < key.NonceSize() {
+		return nil, fmt.Errorf("sealed data is truncated")
+	}
+	return key.Open(nil, data[:key.NonceSize()], data[key.NonceSize():], nil)
+}
+
+// newPIN derives the key for a new PIN along with the salt it was derived
+// with and a check sealed with it. Deriving the key is deliberately slow so
+// this is called without holding v.mux.
+func newPIN(pin []byte) (gocipher.AEAD, []byte, []byte, error) {
+	if len(pin) == 0 {
+		return nil, nil, nil, grpc.Errorf(codes.InvalidArgument, "the PIN can't be empty")
+	}
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, nil, nil, grpc.Errorf(codes.Internal, "unable to generate salt: %v", err)
+	}
+	key, err := newPinKey(pin, salt)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	check, err := seal(key, pinCheck)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return key, salt, check, nil
+}
+
+// setPIN replaces the PIN the vault is locked with by one from newPIN. The
+// caller must hold v.mux.
+func (v *vault) setPIN(key gocipher.AEAD, salt, check []byte) error {
+	if v.locked {
+		return errLocked()
+	}
+	v.pinKey, v.pinSalt, v.pinCheck = key, salt, check
+	v.lastUsed = time.Now().Round(0)
+	return nil
+}
+
+// lock seals every entry with the PIN key and then forgets the key, so
+// nothing can be read until the PIN is given again. Mounted files hold the
+// secrets in the clear so they're removed. The caller must hold v.mux.
+func (v *vault) lock() error {
+	if v.locked {
+		return nil
+	}
+	if v.pinKey == nil {
+		return grpc.Errorf(codes.InvalidArgument, "no PIN has been set")
+	}
+	for name, e := range v.entries {
+		current, err := e.decrypt()
+		if err != nil {
+			log.Errorf("Dropping %q: %v", name, err)
+			v.drop(name)
+			continue
+		}
+		sealed, err := seal(v.pinKey, current)
+		if err != nil {
+			return err
+		}
+		e.data, e.salt, e.encPass = sealed, "", ""
+		e.unmount()
+	}
+	v.pinKey = nil
+	v.locked = true
+	log.Debugln("Locked the stash")
+	return nil
+}
+
+// unlock reverses lock if key, derived from the PIN and salt, is correct.
+// Every entry is dropped after too many wrong PINs. The caller must hold
+// v.mux.
+func (v *vault) unlock(key gocipher.AEAD, salt []byte) error {
+	if !v.locked {
+		return nil
+	}
+	// The PIN may have been replaced while the key was being derived
+	if !bytes.Equal(salt, v.pinSalt) {
+		return grpc.Errorf(codes.Aborted, "the PIN was changed, try again")
+	}
+	if _, err := unseal(key, v.pinCheck); err != nil {
+		v.failedUnlocks++
+		if v.failedUnlocks >= maxUnlockAttempts {
+			log.Infof("Dropping every entry after %d wrong PINs\n", v.failedUnlocks)
+			v.reset()
+			return grpc.Errorf(codes.PermissionDenied, "too many wrong PINs, every entry has been dropped")
+		}
+		return grpc.Errorf(codes.Unauthenticated, "wrong PIN")
+	}
+	for name, e := range v.entries {
+		current, err := unseal(key, e.data)
+		if err == nil {
+			err = e.encrypt(current)
+		}
+		if err != nil {
+			log.Errorf("Dropping %q: %v", name, err)
+			v.drop(name)
+		}
+	}
+	v.pinKey = key
+	v.locked = false
+	v.failedUnlocks = 0
+	v.lastUsed = time.Now().Round(0)
+	log.Debugln("Unlocked the stash")
+	return nil
+}
+
+// idle reports whether the vault should be locked as it hasn't been used
+// for the server's lock-after period. The caller must hold v.mux.
+func (v *vault) idle(now time.Time) bool {
+	lockAfter := v.server.lockAfter
+	return lockAfter > 0 && !v.locked && v.pinKey != nil && now.Round(0).Sub(v.lastUsed) >= lockAfter
+}
+
+// SetPin sets the PIN that Lock seals entries with, which enables locking
+// the vault automatically once it has been idle.
+func (v *vault) SetPin(ctx context.Context, p *pb.Pin) (*pb.Void, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		log.Debugf("Recevied SETPIN request from %s\n", p.Addr)
+	}
+	key, salt, check, err := newPIN(p.GetPin())
+	if err != nil {
+		return &pb.Void{}, err
+	}
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	return &pb.Void{}, v.setPIN(key, salt, check)
+}
+
+// Lock locks the vault, first replacing the PIN if one is given.
+func (v *vault) Lock(ctx context.Context, p *pb.Pin) (*pb.Void, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		log.Debugf("Recevied LOCK request from %s\n", p.Addr)
+	}
+	var key gocipher.AEAD
+	var salt, check []byte
+	if len(p.GetPin()) > 0 {
+		var err error
+		if key, salt, check, err = newPIN(p.GetPin()); err != nil {
+			return &pb.Void{}, err
+		}
+	}
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	if key != nil {
+		if err := v.setPIN(key, salt, check); err != nil {
+			return &pb.Void{}, err
+		}
+	}
+	return &pb.Void{}, v.lock()
+}
+
+func (v *vault) Unlock(ctx context.Context, p *pb.Pin) (*pb.Void, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		log.Debugf("Recevied UNLOCK request from %s\n", p.Addr)
+	}
+	v.mux.Lock()
+	locked, salt := v.locked, v.pinSalt
+	v.mux.Unlock()
+	if !locked {
+		return &pb.Void{}, nil
+	}
+	// Deriving the key is deliberately slow so it's done without blocking
+	// every other request
+	key, err := newPinKey(p.GetPin(), salt)
+	if err != nil {
+		return &pb.Void{}, err
+	}
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	return &pb.Void{}, v.unlock(key, salt)
+}
@@ -2,130 +2,706 @@ package server
 
 import (
 	"context"
+	gocipher "crypto/cipher"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	log "github.com/sirupsen/logrus"
 	"github.com/walkert/cipher"
 	pb "github.com/walkert/stash/stashproto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 )
 
-var (
-	encPass         string
-	masterPassword  []byte
+// entry is a stored password and its fields encrypted with a random salt and
+// password which are replaced every time it's re-encrypted by the watchdog.
+type entry struct {
+	data    []byte
+	encPass string
+	expires time.Time
+	mounts  []string
+	// pid is the process the entry is bound to, or 0 if it isn't bound
+	pid int
+	// pidStart is when pid started, as reported by processStart, so that
+	// another process given the same pid isn't mistaken for it
+	pidStart uint64
+	// readsLeft is how many more times the entry may be fetched before
+	// it's dropped, or 0 if there's no limit
+	readsLeft int64
+	salt      string
+}
+
+// unmount removes the files the entry was written to by clients.
+func (e *entry) unmount() {
+	for _, path := range e.mounts {
+		log.Debugf("Removing %s\n", path)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Errorf("Unable to remove %s: %v\n", path, err)
+		}
+	}
+	e.mounts = nil
+}
+
+// expired reports whether the entry's own TTL has passed. e.expires has no
+// monotonic clock reading so the comparison uses the wall clock and time
+// spent suspended counts.
+func (e *entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// processExists reports whether pid is a running process. A process owned
+// by another user still exists even though it can't be signalled.
+func processExists(pid int) bool {
+	return syscall.Kill(pid, 0) != syscall.ESRCH
+}
+
+// processStart returns when pid started, in clock ticks since boot, or 0
+// if that can't be found out, such as on systems without /proc.
+func processStart(pid int) uint64 {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0
+	}
+	// The command name is in parentheses and may itself contain spaces or
+	// parentheses, so the fields are counted from the last one. The start
+	// time is the 22nd field and the state, which follows the name, the 3rd.
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 20 {
+		return 0
+	}
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return start
+}
+
+// stale returns the reason the entry should be dropped, or "" if it's still
+// valid.
+func (e *entry) stale(now time.Time) string {
+	if e.expired(now) {
+		return "it has expired"
+	}
+	if e.pid > 0 && (!processExists(e.pid) || processStart(e.pid) != e.pidStart) {
+		return fmt.Sprintf("process %d has exited", e.pid)
+	}
+	return ""
+}
+
+func (e *entry) encrypt(password []byte) error {
+	salt := cipher.RandomString(12)
+	encPass := cipher.RandomString(32)
+	data, err := cipher.EncryptBytes(password, salt, encPass)
+	if err != nil {
+		return err
+	}
+	e.data, e.salt, e.encPass = data, salt, encPass
+	return nil
+}
+
+func (e *entry) decrypt() ([]byte, error) {
+	data, err := cipher.DecryptBytes(e.data, e.salt, e.encPass)
+	if err != nil {
+		return []byte{}, fmt.Errorf("unable to decrypt password data: %v\n", err)
+	}
+	return data, nil
+}
+
+// chunkSize is the amount of data sent in each message of a Download.
+const chunkSize = 64 * 1024
+
+// DefaultMaxSize is the largest entry the server accepts unless changed by
+// SetMaxSize.
+const DefaultMaxSize = 1024 * 1024
+
+type vault struct {
+	entries       map[string]*entry
+	failedUnlocks int
+	// lastUsed is when an entry was last stored or fetched, used to lock
+	// the vault once it's idle
+	lastUsed time.Time
+	// locked is set while the entries are sealed with the PIN key. The key
+	// itself is only kept while the vault is unlocked.
+	locked          bool
 	mux             sync.Mutex
-	salt            string
+	pinCheck        []byte
+	pinKey          gocipher.AEAD
+	pinSalt         []byte
+	server          *Server
 	watchDogRunning bool
-)
+}
 
-type vault struct{}
+func newVault(server *Server) *vault {
+	return &vault{entries: map[string]*entry{}, server: server}
+}
 
-func (v *vault) Get(ctx context.Context, void *pb.Void) (*pb.Payload, error) {
-	if p, ok := peer.FromContext(ctx); ok {
-		log.Debugf("Recevied GET request from %s\n", p.Addr)
+func notSet(name string) error {
+	if name == "" {
+		return grpc.Errorf(codes.NotFound, "password not set")
+	}
+	return grpc.Errorf(codes.NotFound, "%s not set", name)
+}
+
+// lookup returns the entry called name, dropping it if it has expired or the
+// process it's bound to has exited. The caller must hold v.mux.
+func (v *vault) lookup(name string) (*entry, bool) {
+	e, ok := v.entries[name]
+	if !ok {
+		return nil, false
 	}
-	if len(masterPassword) == 0 {
-		return &pb.Payload{}, grpc.Errorf(codes.NotFound, "password not set")
+	if reason := e.stale(time.Now()); reason != "" {
+		log.Debugf("Dropping %q as %s\n", name, reason)
+		v.drop(name)
+		return nil, false
 	}
-	decrypted, err := decryptPass()
+	return e, true
+}
+
+// drop removes the entry called name along with any files it was mounted
+// to. The caller must hold v.mux.
+func (v *vault) drop(name string) {
+	if e, ok := v.entries[name]; ok {
+		e.unmount()
+		delete(v.entries, name)
+	}
+}
+
+// fetch returns the decrypted password and fields of the entry called name.
+func (v *vault) fetch(name string) (*pb.Payload, error) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	current, ok := v.lookup(name)
+	if !ok {
+		return &pb.Payload{}, notSet(name)
+	}
+	if v.locked {
+		return &pb.Payload{}, errLocked()
+	}
+	v.lastUsed = time.Now().Round(0)
+	decrypted, err := current.decrypt()
 	if err != nil {
 		return &pb.Payload{}, err
 	}
-	return &pb.Payload{Password: decrypted}, nil
+	payload := &pb.Payload{}
+	if err := proto.Unmarshal(decrypted, payload); err != nil {
+		return &pb.Payload{}, grpc.Errorf(codes.Internal, "unable to decode password data: %v", err)
+	}
+	payload.Name = name
+	if current.readsLeft > 0 {
+		current.readsLeft--
+		if current.readsLeft == 0 {
+			log.Debugf("Dropping %q after its last read\n", name)
+			v.drop(name)
+		}
+	}
+	return payload, nil
+}
+
+// store encrypts the password and fields in payload and saves them as the
+// entry called payload.Name, replacing any existing entry. It returns the new
+// entry.
+func (v *vault) store(payload *pb.Payload) (*entry, error) {
+	size := int64(len(payload.GetPassword()))
+	for _, f := range payload.GetFields() {
+		size += int64(len(f.GetValue()))
+	}
+	if err := v.server.checkSize(size); err != nil {
+		return nil, err
+	}
+	// Binding only makes sense when the client runs on the same host
+	pid := int(payload.GetBindPid())
+	if pid < 0 || (pid > 0 && !processExists(pid)) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "process %d isn't running", pid)
+	}
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	if v.locked {
+		return nil, errLocked()
+	}
+	name := payload.GetName()
+	now := time.Now().Round(0)
+	v.lastUsed = now
+	e := &entry{pid: pid, readsLeft: payload.GetMaxReads()}
+	if pid > 0 {
+		e.pidStart = processStart(pid)
+	}
+	if payload.GetTtl() > 0 {
+		e.expires = now.Add(time.Second * time.Duration(payload.GetTtl()))
+	}
+	if payload.GetExpiresAt() > 0 {
+		at := time.Unix(payload.GetExpiresAt(), 0)
+		if !at.After(now) {
+			return nil, grpc.Errorf(codes.InvalidArgument, "expiry time %s has already passed", at.Format("2006-01-02 15:04:05"))
+		}
+		if e.expires.IsZero() || at.Before(e.expires) {
+			e.expires = at
+		}
+	}
+	// The password and fields are kept together so the watchdog can
+	// re-encrypt them in one go
+	data, err := proto.Marshal(&pb.Payload{Password: payload.GetPassword(), Fields: payload.GetFields()})
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "unable to encode password data: %v", err)
+	}
+	if err := e.encrypt(data); err != nil {
+		return nil, grpc.Errorf(codes.Internal, "unable to encrypt password: %v", err)
+	}
+	// Files holding the old value are out of date
+	v.drop(name)
+	v.entries[name] = e
+	if !v.watchDogRunning {
+		go v.watchDog()
+		v.watchDogRunning = true
+	}
+	return e, nil
+}
+
+func (v *vault) Get(ctx context.Context, e *pb.Entry) (*pb.Payload, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		log.Debugf("Recevied GET request from %s\n", p.Addr)
+	}
+	return v.fetch(e.GetName())
 }
 
 func (v *vault) Set(ctx context.Context, payload *pb.Payload) (*pb.Void, error) {
 	if p, ok := peer.FromContext(ctx); ok {
 		log.Debugf("Recevied SET request from %s\n", p.Addr)
 	}
-	encryptPass(payload.GetPassword())
-	if !watchDogRunning {
-		go watchDog()
-		watchDogRunning = true
+	_, err := v.store(payload)
+	return &pb.Void{}, err
+}
+
+// Hold stores payload like Set but only for as long as the client keeps the
+// stream open. A message is sent once the entry is stored and the stream is
+// ended if the entry is dropped or replaced in the meantime.
+func (v *vault) Hold(payload *pb.Payload, stream pb.Stash_HoldServer) error {
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		log.Debugf("Recevied HOLD request from %s\n", p.Addr)
+	}
+	name := payload.GetName()
+	held, err := v.store(payload)
+	if err != nil {
+		return err
+	}
+	// Only drop the entry if it's still the one being held
+	defer func() {
+		v.mux.Lock()
+		defer v.mux.Unlock()
+		if v.entries[name] == held {
+			log.Debugf("Dropping %q as its holder has gone\n", name)
+			v.drop(name)
+		}
+	}()
+	if err := stream.Send(&pb.Void{}); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(time.Second * 5)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+			v.mux.Lock()
+			current, ok := v.lookup(name)
+			v.mux.Unlock()
+			if !ok || current != held {
+				return notSet(name)
+			}
+		}
 	}
-	return &pb.Void{}, nil
 }
 
-type Server struct {
-	clientAuth  string
-	l           net.Listener
-	expiration  time.Duration
-	host        string
-	passwordSet bool
-	port        int
-	s           *grpc.Server
+// Download sends the password of the entry called e.Name in chunks so that
+// large files aren't limited by the size of a single message.
+func (v *vault) Download(e *pb.Entry, stream pb.Stash_DownloadServer) error {
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		log.Debugf("Recevied DOWNLOAD request from %s\n", p.Addr)
+	}
+	payload, err := v.fetch(e.GetName())
+	if err != nil {
+		return err
+	}
+	data := payload.GetPassword()
+	if len(data) == 0 {
+		return grpc.Errorf(codes.NotFound, "%s has no data", e.GetName())
+	}
+	for len(data) > 0 {
+		n := chunkSize
+		if len(data) < n {
+			n = len(data)
+		}
+		if err := stream.Send(&pb.Chunk{Data: data[:n]}); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
 }
 
-func watchDog() {
-	timer := time.NewTicker(time.Second * 5)
+// Upload stores the chunks sent by the client as the password of the entry
+// named in the first chunk.
+func (v *vault) Upload(stream pb.Stash_UploadServer) error {
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		log.Debugf("Recevied UPLOAD request from %s\n", p.Addr)
+	}
+	var (
+		data  []byte
+		first *pb.Chunk
+	)
 	for {
-		now := <-timer.C
-		// Stop the watchdog when there's no longer a password set
-		if len(masterPassword) == 0 {
-			log.Debug("Stopping the watchdog at", now)
-			return
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if first == nil {
+			first = chunk
 		}
-		current, _ := decryptPass()
-		encryptPass(current)
+		data = append(data, chunk.GetData()...)
+		// Give up as soon as the limit is passed rather than buffering
+		// everything the client sends
+		if err := v.server.checkSize(int64(len(data))); err != nil {
+			return err
+		}
+	}
+	if first == nil {
+		return grpc.Errorf(codes.InvalidArgument, "no data uploaded")
+	}
+	payload := &pb.Payload{
+		Password:  data,
+		Name:      first.GetName(),
+		Ttl:       first.GetTtl(),
+		MaxReads:  first.GetMaxReads(),
+		BindPid:   first.GetBindPid(),
+		ExpiresAt: first.GetExpiresAt(),
+	}
+	if _, err := v.store(payload); err != nil {
+		return err
 	}
+	return stream.SendAndClose(&pb.Void{})
 }
 
-func encryptPass(password []byte) error {
-	mux.Lock()
-	defer mux.Unlock()
-	salt = cipher.RandomString(12)
-	encPass = cipher.RandomString(32)
-	data, err := cipher.EncryptBytes(password, salt, encPass)
+func (v *vault) Delete(ctx context.Context, e *pb.Entry) (*pb.Void, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		log.Debugf("Recevied DELETE request from %s\n", p.Addr)
+	}
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	if _, ok := v.lookup(e.GetName()); !ok {
+		return &pb.Void{}, notSet(e.GetName())
+	}
+	v.drop(e.GetName())
+	return &pb.Void{}, nil
+}
+
+// DefaultMountDir returns the directory mounted files must be in unless
+// changed by SetMountDir. It's inside the user's runtime directory, which is
+// usually a tmpfs.
+func DefaultMountDir() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	return filepath.Join(dir, "stash")
+}
+
+// mountDir creates the directory mounted files must be in if it doesn't
+// exist and returns its real path. It must only be usable by the server's
+// user since the server deletes the files in it.
+func (s *Server) mountDir() (string, error) {
+	if err := os.MkdirAll(s.mounts, 0700); err != nil {
+		return "", fmt.Errorf("unable to create %s: %v", s.mounts, err)
+	}
+	dir, err := filepath.EvalSymlinks(s.mounts)
 	if err != nil {
-		return err
+		return "", err
 	}
-	masterPassword = data
-	return nil
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !info.IsDir() || info.Mode().Perm()&0077 != 0 || !ok || int(stat.Uid) != os.Getuid() {
+		return "", fmt.Errorf("%s must be a directory only usable by its owner", s.mounts)
+	}
+	return dir, nil
 }
 
-func decryptPass() ([]byte, error) {
-	mux.Lock()
-	defer mux.Unlock()
-	data, err := cipher.DecryptBytes(masterPassword, salt, encPass)
+// Mount records that a client has written the entry called m.Name to the
+// file at m.Path so the server can remove it when the entry is dropped.
+// Since the server deletes the file later, only files in its mount
+// directory are accepted.
+func (v *vault) Mount(ctx context.Context, m *pb.Mount) (*pb.Void, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		log.Debugf("Recevied MOUNT request from %s\n", p.Addr)
+	}
+	dir, err := v.server.mountDir()
 	if err != nil {
-		return []byte{}, fmt.Errorf("unable to decrypt password data: %v\n", err)
+		return &pb.Void{}, grpc.Errorf(codes.Internal, "unable to use the mount directory: %v", err)
 	}
-	return data, nil
+	if !filepath.IsAbs(m.GetPath()) {
+		return &pb.Void{}, grpc.Errorf(codes.InvalidArgument, "%s isn't an absolute path", m.GetPath())
+	}
+	// Symlinks are resolved so they can't point the server outside dir
+	path, err := filepath.EvalSymlinks(m.GetPath())
+	if err != nil {
+		return &pb.Void{}, grpc.Errorf(codes.InvalidArgument, "unable to check %s: %v", m.GetPath(), err)
+	}
+	if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return &pb.Void{}, grpc.Errorf(codes.InvalidArgument, "%s isn't inside %s", m.GetPath(), dir)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return &pb.Void{}, grpc.Errorf(codes.InvalidArgument, "unable to check %s: %v", path, err)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0077 != 0 || !ok || int(stat.Uid) != os.Getuid() {
+		return &pb.Void{}, grpc.Errorf(codes.InvalidArgument, "%s must be a regular file only readable by its owner", path)
+	}
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	current, ok := v.lookup(m.GetName())
+	if !ok {
+		return &pb.Void{}, notSet(m.GetName())
+	}
+	current.mounts = append(current.mounts, path)
+	return &pb.Void{}, nil
 }
 
-func (s *Server) AuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+func (v *vault) List(ctx context.Context, void *pb.Void) (*pb.EntryList, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		log.Debugf("Recevied LIST request from %s\n", p.Addr)
+	}
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	var names []string
+	for name := range v.entries {
+		if _, ok := v.lookup(name); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	list := &pb.EntryList{}
+	for _, name := range names {
+		list.Entries = append(list.Entries, &pb.Entry{Name: name})
+	}
+	return list, nil
+}
+
+func (v *vault) Status(ctx context.Context, e *pb.Entry) (*pb.Status, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		log.Debugf("Recevied STATUS request from %s\n", p.Addr)
+	}
+	v.mux.Lock()
+	current, ok := v.lookup(e.GetName())
+	var readsLeft int64
+	if ok {
+		readsLeft = current.readsLeft
+	}
+	locked := v.locked
+	v.mux.Unlock()
+	if !ok {
+		return &pb.Status{}, nil
+	}
+	// The entry goes at whichever comes first of its own TTL and the
+	// server's expiration
+	expires := v.server.expiresAt()
+	if !current.expires.IsZero() && (expires.IsZero() || current.expires.Before(expires)) {
+		expires = current.expires
+	}
+	status := &pb.Status{Set: true, ReadsLeft: readsLeft, Locked: locked}
+	if !expires.IsZero() {
+		status.Expires = expires.Unix()
+	}
+	return status, nil
+}
+
+// clear drops every entry.
+func (v *vault) clear() {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	v.reset()
+}
+
+// reset drops every entry and the PIN. The caller must hold v.mux.
+func (v *vault) reset() {
+	for _, e := range v.entries {
+		e.unmount()
+	}
+	v.entries = map[string]*entry{}
+	v.locked = false
+	v.failedUnlocks = 0
+	v.pinCheck, v.pinKey, v.pinSalt = nil, nil, nil
+}
+
+func (v *vault) watchDog() {
+	timer := time.NewTicker(time.Second * 5)
+	defer timer.Stop()
+	for {
+		if !v.check(<-timer.C) {
+			return
+		}
+	}
+}
+
+// check does the watchdog's work at now: it locks the vault once it's idle,
+// drops stale entries and re-encrypts the rest. It returns false, stopping
+// the watchdog, when there are no entries left.
+func (v *vault) check(now time.Time) bool {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	// Stop the watchdog when there's no longer a password set
+	if len(v.entries) == 0 {
+		log.Debug("Stopping the watchdog at", now)
+		v.watchDogRunning = false
+		return false
+	}
+	if v.idle(now) {
+		log.Debugln("Locking the idle stash at", now)
+		if err := v.lock(); err != nil {
+			log.Errorf("Unable to lock the stash: %v\n", err)
+		}
+	}
+	for name, e := range v.entries {
+		if reason := e.stale(now); reason != "" {
+			log.Debugf("Dropping %q as %s\n", name, reason)
+			v.drop(name)
+			continue
+		}
+		// Sealed entries can't be re-encrypted without the PIN
+		if v.locked {
+			continue
+		}
+		current, err := e.decrypt()
+		if err == nil {
+			err = e.encrypt(current)
+		}
+		if err != nil {
+			log.Errorf("Dropping %q: %v", name, err)
+			v.drop(name)
+		}
+	}
+	return true
+}
+
+// clockInterval is how often the server checks its expiration and the wall
+// clock.
+const clockInterval = time.Second
+
+// maxClockJump is how far the wall clock may move ahead of the monotonic
+// clock between checks before the system is assumed to have been suspended.
+const maxClockJump = time.Minute
+
+type Server struct {
+	clientAuth string
+	// done is closed by Stop
+	done       chan struct{}
+	l          net.Listener
+	maxSize    int64
+	expiration time.Duration
+	// expireAt is the time of day, as an offset from midnight, at which
+	// everything is dropped, or -1 if there's no daily expiry
+	expireAt      time.Duration
+	expires       time.Time
+	health        *health.Server
+	host          string
+	lockAfter     time.Duration
+	mounts        string
+	mux           sync.Mutex
+	passwordSet   bool
+	port          int
+	s             *grpc.Server
+	vault         *vault
+	wipeOnSuspend bool
+}
+
+// pinMethods are only allowed for the client whose entries they protect.
+var pinMethods = map[string]bool{
+	"/stashproto.Stash/SetPin": true,
+	"/stashproto.Stash/Lock":   true,
+	"/stashproto.Stash/Unlock": true,
+}
+
+// authorize checks the auth token sent with a call to method. The first
+// client to store an entry becomes the only one allowed to use the server
+// until it expires.
+func (s *Server) authorize(ctx context.Context, method string) error {
+	// Health checks reveal nothing at all so they don't require auth. Status
+	// does since it reveals which entries exist and when they expire.
+	if method == "/grpc.health.v1.Health/Check" {
+		return nil
+	}
 	meta, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return nil, grpc.Errorf(codes.Unauthenticated, "missing context header")
+		return grpc.Errorf(codes.Unauthenticated, "missing context header")
 	}
 	if len(meta["auth"]) != 1 {
-		return nil, grpc.Errorf(codes.Unauthenticated, "invalid auth token")
+		return grpc.Errorf(codes.Unauthenticated, "invalid auth token")
 	}
 	value := meta["auth"][0]
-	if info.FullMethod == "/stashproto.Stash/Get" {
-		if s.passwordSet {
-			if value != s.clientAuth {
-				return nil, grpc.Errorf(codes.Unauthenticated, "invalid auth token")
-			}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if method == "/stashproto.Stash/Set" || method == "/stashproto.Stash/Upload" || method == "/stashproto.Stash/Hold" {
+		// Entries set by another client can't be decrypted by this one
+		// so there's no point keeping them
+		if s.passwordSet && value != s.clientAuth {
+			log.Debugln("Dropping existing entries for new client")
+			s.vault.clear()
 		}
-	}
-	if info.FullMethod == "/stashproto.Stash/Set" {
 		s.clientAuth = value
 		s.passwordSet = true
+	} else if s.passwordSet && value != s.clientAuth {
+		return grpc.Errorf(codes.Unauthenticated, "invalid auth token")
+	} else if !s.passwordSet && pinMethods[method] {
+		// Until a client has stored something there's no token to check,
+		// and no one else should be able to lock the stash
+		return grpc.Errorf(codes.Unauthenticated, "invalid auth token")
+	}
+	return nil
+}
+
+func (s *Server) AuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
 	}
 	return handler(ctx, req)
 }
 
+// StreamAuthInterceptor applies the same checks as AuthInterceptor to
+// streaming calls such as Upload and Download.
+func (s *Server) StreamAuthInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
 func New(host string, port int, certFile, keyFile string, expiration int) (*Server, error) {
-	svr := &Server{host: host, port: port, expiration: time.Hour * time.Duration(expiration)}
-	options := []grpc.ServerOption{grpc.UnaryInterceptor(svr.AuthInterceptor)}
+	svr := &Server{done: make(chan struct{}), host: host, port: port, expiration: time.Hour * time.Duration(expiration), expireAt: -1, maxSize: DefaultMaxSize, mounts: DefaultMountDir()}
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(svr.AuthInterceptor),
+		grpc.StreamInterceptor(svr.StreamAuthInterceptor),
+	}
 	if certFile != "" && keyFile != "" {
 		creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
 		if err != nil {
@@ -138,24 +714,142 @@ func New(host string, port int, certFile, keyFile string, expiration int) (*Serv
 		return &Server{}, fmt.Errorf("failed to listen: %v", err)
 	}
 	s := grpc.NewServer(options...)
-	pb.RegisterStashServer(s, &vault{})
+	svr.vault = newVault(svr)
+	pb.RegisterStashServer(s, svr.vault)
+	svr.health = health.NewServer()
+	healthpb.RegisterHealthServer(s, svr.health)
 	svr.l = lis
 	svr.s = s
 	return svr, nil
 }
 
-func (s *Server) Start() error {
+// SetMaxSize sets the largest entry, in bytes, that the server accepts. It
+// must be called before Start.
+func (s *Server) SetMaxSize(size int64) {
+	s.maxSize = size
+}
+
+// SetExpireAt makes the server drop everything at hour:minute local time
+// every day as well as after its expiration. It must be called before Start.
+func (s *Server) SetExpireAt(hour, minute int) {
+	s.expireAt = time.Hour*time.Duration(hour) + time.Minute*time.Duration(minute)
+}
+
+// SetMountDir sets the directory that files written by Client.Mount must be
+// in. It must be called before Start.
+func (s *Server) SetMountDir(dir string) {
+	s.mounts = dir
+}
+
+// SetLockAfter makes the server lock the vault once no entry has been
+// stored or fetched for d. It only applies once a PIN has been set. It must
+// be called before Start.
+func (s *Server) SetLockAfter(d time.Duration) {
+	s.lockAfter = d
+}
+
+// SetWipeOnSuspend makes the server drop everything when it notices the
+// system has been suspended. It must be called before Start.
+func (s *Server) SetWipeOnSuspend(wipe bool) {
+	s.wipeOnSuspend = wipe
+}
+
+func (s *Server) checkSize(size int64) error {
+	if s.maxSize > 0 && size > s.maxSize {
+		return grpc.Errorf(codes.ResourceExhausted, "entry is larger than the limit of %d bytes", s.maxSize)
+	}
+	return nil
+}
+
+// expiresAt returns the time at which the password will next be dropped or
+// the zero time if the password never expires.
+func (s *Server) expiresAt() time.Time {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.expires
+}
+
+// NextClock returns the next time after now that it's hour:minute in now's
+// location. The hour and minute are set directly rather than added to
+// midnight so that daylight saving changes don't move them.
+func NextClock(now time.Time, hour, minute int) time.Time {
+	year, month, day := now.Date()
+	next := time.Date(year, month, day, hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = time.Date(year, month, day+1, hour, minute, 0, 0, now.Location())
+	}
+	return next
+}
+
+// nextExpiry returns the wall clock time after now at which everything will
+// next be dropped, or the zero time if it never is.
+func (s *Server) nextExpiry(now time.Time) time.Time {
+	now = now.Round(0)
+	var next time.Time
 	if s.expiration > 0 {
-		go func() {
-			timer := time.NewTicker(s.expiration)
-			for {
-				now := <-timer.C
-				log.Debugln("Dropping the password at", now)
-				s.clientAuth = ""
-				s.passwordSet = false
-				masterPassword = nil
-			}
-		}()
+		next = now.Add(s.expiration)
+	}
+	if s.expireAt >= 0 {
+		daily := NextClock(now, int(s.expireAt/time.Hour), int(s.expireAt%time.Hour/time.Minute))
+		if next.IsZero() || daily.Before(next) {
+			next = daily
+		}
+	}
+	return next
+}
+
+// expire drops every entry and forgets the client that stored them.
+func (s *Server) expire(now time.Time) {
+	s.mux.Lock()
+	s.expires = s.nextExpiry(now)
+	s.clientAuth = ""
+	s.passwordSet = false
+	s.mux.Unlock()
+	s.vault.clear()
+}
+
+// jump returns how far the wall clock moved ahead between the readings
+// last and now while the monotonic clock only moved on by elapsed. The two
+// only differ by much when the system has been suspended or the clock set.
+func jump(last, now time.Time, elapsed time.Duration) time.Duration {
+	return now.Sub(last) - elapsed
+}
+
+// watchClock drops everything when the server's expiration passes and, with
+// wipeOnSuspend, after the system has been suspended. Go's timers use the
+// monotonic clock, which stops while the system is suspended, so both are
+// checked against the wall clock instead.
+func (s *Server) watchClock() {
+	ticker := time.NewTicker(clockInterval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		var now time.Time
+		select {
+		case <-s.done:
+			return
+		case now = <-ticker.C:
+		}
+		ahead := jump(last.Round(0), now.Round(0), now.Sub(last))
+		last = now
+		if s.wipeOnSuspend && ahead > maxClockJump {
+			log.Infof("Dropping the password as the clock jumped ahead by %s\n", ahead)
+			s.expire(now)
+			continue
+		}
+		if expires := s.expiresAt(); !expires.IsZero() && !now.Round(0).Before(expires) {
+			log.Debugln("Dropping the password at", now)
+			s.expire(now)
+		}
+	}
+}
+
+func (s *Server) Start() error {
+	s.mux.Lock()
+	s.expires = s.nextExpiry(time.Now())
+	s.mux.Unlock()
+	if !s.expires.IsZero() || s.wipeOnSuspend {
+		go s.watchClock()
 	}
 	log.Debugf("grpc server listening on: %s:%d\n", s.host, s.port)
 	if err := s.s.Serve(s.l); err != nil {
@@ -164,6 +858,16 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// Stop shuts the server down, removing any files entries were mounted to.
 func (s *Server) Stop() {
+	s.mux.Lock()
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	s.mux.Unlock()
+	s.health.Shutdown()
 	s.s.Stop()
+	s.vault.clear()
 }
@@ -1,11 +1,15 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/walkert/stash/client"
 )
@@ -18,7 +22,7 @@ func TestServerSetGet(t *testing.T) {
 	go func() {
 		err := s.Start()
 		if err != nil {
-			t.Fatalf("problem starting server: %v", err)
+			t.Errorf("problem starting server: %v", err)
 		}
 	}()
 	defer s.Stop()
@@ -27,7 +31,11 @@ func TestServerSetGet(t *testing.T) {
 		t.Fatalf("unable to create temp file: %s\n", err)
 	}
 	defer os.Remove(file.Name())
-	c, err := client.New(5002, file.Name(), "")
+	c, err := client.New(
+		"localhost:5002",
+		client.WithConfig(file.Name()),
+		client.WithPasswordSource(client.ReaderSource(strings.NewReader("test"))),
+	)
 	if err != nil {
 		t.Fatalf("unexpected error while getting client: %v\n", err)
 	}
@@ -37,19 +45,21 @@ func TestServerSetGet(t *testing.T) {
 	}
 	file.WriteString(fmt.Sprintf("random:saltandpasswordstring"))
 	file.Close()
-	_, err = c.GetPassword()
+	_, err = c.GetPassword(context.Background())
 	if err == nil {
 		t.Fatalf("expected error getting empty password but got none")
 	}
 	if !strings.Contains(err.Error(), "password not set") {
 		t.Fatalf("unexpected error while getting empty password")
 	}
-	client.TestPass = []byte("test")
-	err = c.SetPassword()
+	if client.ErrorKind(err) != client.KindNotSet {
+		t.Fatalf("Wanted error kind %d, got: %d\n", client.KindNotSet, client.ErrorKind(err))
+	}
+	err = c.SetPassword(context.Background())
 	if err != nil {
 		t.Fatalf("unexpected error while setting password: %v\n", err)
 	}
-	pass, err := c.GetPassword()
+	pass, err := c.GetPassword(context.Background())
 	if err != nil {
 		t.Fatalf("unexpected error while getting password: %v\n", err)
 	}
@@ -66,7 +76,7 @@ func TestServerVarious(t *testing.T) {
 	go func() {
 		err := s.Start()
 		if err != nil {
-			t.Fatalf("problem starting server: %v", err)
+			t.Errorf("problem starting server: %v", err)
 		}
 	}()
 	defer s.Stop()
@@ -75,12 +85,15 @@ func TestServerVarious(t *testing.T) {
 		t.Fatalf("unable to create temp file: %s\n", err)
 	}
 	defer os.Remove(file.Name())
-	c, err := client.New(5002, file.Name(), "")
+	c, err := client.New(
+		"localhost:5002",
+		client.WithConfig(file.Name()),
+		client.WithPasswordSource(client.ReaderSource(strings.NewReader("test"))),
+	)
 	if err != nil {
 		t.Fatalf("unexpected error while getting client: %v\n", err)
 	}
-	client.TestPass = []byte("test")
-	err = c.SetPassword()
+	err = c.SetPassword(context.Background())
 	if err != nil {
 		t.Fatalf("unexpected error while setting password: %v\n", err)
 	}
@@ -91,11 +104,750 @@ func TestServerVarious(t *testing.T) {
 	}
 	file.WriteString("bad:saltandpasswordstring")
 	file.Close()
-	_, err = c.GetPassword()
+	_, err = c.GetPassword(context.Background())
 	if err == nil {
 		t.Fatalf("expected error but got none")
 	}
 	if !strings.Contains(err.Error(), "invalid auth token") {
 		t.Fatalf("Unexpected error string: %s\n", err.Error())
 	}
+	if client.ErrorKind(err) != client.KindAuth {
+		t.Fatalf("Wanted error kind %d, got: %d\n", client.KindAuth, client.ErrorKind(err))
+	}
+}
+
+func TestServerStatus(t *testing.T) {
+	s, err := New("localhost", 5002, "", "", 1)
+	if err != nil {
+		t.Fatalf("problem starting server: %v", err)
+	}
+	go func() {
+		err := s.Start()
+		if err != nil {
+			t.Errorf("problem starting server: %v", err)
+		}
+	}()
+	defer s.Stop()
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(file.Name())
+	c, err := client.New(
+		"localhost:5002",
+		client.WithConfig(file.Name()),
+		client.WithPasswordSource(client.ReaderSource(strings.NewReader("test"))),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	st, err := c.Status(context.Background(), "")
+	if err != nil {
+		t.Fatalf("unexpected error while getting status: %v\n", err)
+	}
+	if st.Set {
+		t.Fatalf("expected password to be unset")
+	}
+	err = c.SetPassword(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error while setting password: %v\n", err)
+	}
+	st, err = c.Status(context.Background(), "")
+	if err != nil {
+		t.Fatalf("unexpected error while getting status: %v\n", err)
+	}
+	if !st.Set {
+		t.Fatalf("expected password to be set")
+	}
+	if st.Expires.Before(time.Now().Add(time.Minute*59)) || st.Expires.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("unexpected expiry time: %v\n", st.Expires)
+	}
+	// Another client can't find out about the entries
+	other, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(other.Name())
+	other.WriteString("other:saltandpasswordstring")
+	other.Close()
+	c2, err := client.New("localhost:5002", client.WithConfig(other.Name()))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	if _, err := c2.Status(context.Background(), ""); client.ErrorKind(err) != client.KindAuth {
+		t.Fatalf("Wanted error kind %d, got: %v\n", client.KindAuth, err)
+	}
+}
+
+func TestServerEntries(t *testing.T) {
+	s, err := New("localhost", 5002, "", "", 0)
+	if err != nil {
+		t.Fatalf("problem starting server: %v", err)
+	}
+	go func() {
+		err := s.Start()
+		if err != nil {
+			t.Errorf("problem starting server: %v", err)
+		}
+	}()
+	defer s.Stop()
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(file.Name())
+	c, err := client.New("localhost:5002", client.WithConfig(file.Name()))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	ctx := context.Background()
+	for _, name := range []string{"one", "two"} {
+		if err := c.Set(ctx, name, []byte(name+"-value")); err != nil {
+			t.Fatalf("unexpected error while setting %s: %v\n", name, err)
+		}
+	}
+	for _, name := range []string{"one", "two"} {
+		value, err := c.Get(ctx, name)
+		if err != nil {
+			t.Fatalf("unexpected error while getting %s: %v\n", name, err)
+		}
+		if value != name+"-value" {
+			t.Fatalf("Wanted: '%s-value', got: %s\n", name, value)
+		}
+	}
+	if err := c.Delete(ctx, "one"); err != nil {
+		t.Fatalf("unexpected error while deleting: %v\n", err)
+	}
+	_, err = c.Get(ctx, "one")
+	if client.ErrorKind(err) != client.KindNotSet {
+		t.Fatalf("expected deleted entry to be unset, got: %v\n", err)
+	}
+	// A new client replaces the existing entries
+	other, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(other.Name())
+	c2, err := client.New("localhost:5002", client.WithConfig(other.Name()))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	if err := c2.Set(ctx, "three", []byte("three")); err != nil {
+		t.Fatalf("unexpected error while setting: %v\n", err)
+	}
+	_, err = c2.Get(ctx, "two")
+	if client.ErrorKind(err) != client.KindNotSet {
+		t.Fatalf("expected entry from old client to be dropped, got: %v\n", err)
+	}
+}
+
+func TestServerTTL(t *testing.T) {
+	s, err := New("localhost", 5002, "", "", 0)
+	if err != nil {
+		t.Fatalf("problem starting server: %v", err)
+	}
+	go func() {
+		err := s.Start()
+		if err != nil {
+			t.Errorf("problem starting server: %v", err)
+		}
+	}()
+	defer s.Stop()
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(file.Name())
+	c, err := client.New("localhost:5002", client.WithConfig(file.Name()))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	ctx := context.Background()
+	if err := c.Set(ctx, "short", []byte("short"), client.TTL(time.Second)); err != nil {
+		t.Fatalf("unexpected error while setting: %v\n", err)
+	}
+	if err := c.Set(ctx, "long", []byte("long")); err != nil {
+		t.Fatalf("unexpected error while setting: %v\n", err)
+	}
+	names, err := c.List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error while listing: %v\n", err)
+	}
+	if strings.Join(names, ",") != "long,short" {
+		t.Fatalf("Wanted: 'long,short', got: %v\n", names)
+	}
+	time.Sleep(time.Millisecond * 1100)
+	_, err = c.Get(ctx, "short")
+	if client.ErrorKind(err) != client.KindNotSet {
+		t.Fatalf("expected entry to have expired, got: %v\n", err)
+	}
+	names, err = c.List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error while listing: %v\n", err)
+	}
+	if strings.Join(names, ",") != "long" {
+		t.Fatalf("Wanted: 'long', got: %v\n", names)
+	}
+}
+
+func TestServerFiles(t *testing.T) {
+	s, err := New("localhost", 5002, "", "", 0)
+	if err != nil {
+		t.Fatalf("problem starting server: %v", err)
+	}
+	s.SetMaxSize(200 * 1024)
+	go func() {
+		err := s.Start()
+		if err != nil {
+			t.Errorf("problem starting server: %v", err)
+		}
+	}()
+	defer s.Stop()
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(file.Name())
+	c, err := client.New("localhost:5002", client.WithConfig(file.Name()))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	ctx := context.Background()
+	// Large enough to need several chunks
+	data := bytes.Repeat([]byte("0123456789"), 15*1024)
+	if err := c.Upload(ctx, "key", bytes.NewReader(data)); err != nil {
+		t.Fatalf("unexpected error while uploading: %v\n", err)
+	}
+	var out bytes.Buffer
+	if err := c.Download(ctx, "key", &out); err != nil {
+		t.Fatalf("unexpected error while downloading: %v\n", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("downloaded %d bytes, wanted the %d uploaded\n", out.Len(), len(data))
+	}
+	// Data that fills whole chunks is padded in a chunk of its own
+	data = bytes.Repeat([]byte("x"), 128*1024)
+	if err := c.Upload(ctx, "aligned", bytes.NewReader(data)); err != nil {
+		t.Fatalf("unexpected error while uploading: %v\n", err)
+	}
+	out.Reset()
+	if err := c.Download(ctx, "aligned", &out); err != nil {
+		t.Fatalf("unexpected error while downloading: %v\n", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("downloaded %d bytes, wanted the %d uploaded\n", out.Len(), len(data))
+	}
+	err = c.Upload(ctx, "big", bytes.NewReader(bytes.Repeat(data, 2)))
+	if err == nil || !strings.Contains(err.Error(), "larger than the limit") {
+		t.Fatalf("expected an error uploading more than the limit, got: %v\n", err)
+	}
+	// Streams need the same auth as everything else
+	other, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(other.Name())
+	other.WriteString("other:saltandpasswordstring")
+	other.Close()
+	c2, err := client.New("localhost:5002", client.WithConfig(other.Name()))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	err = c2.Download(ctx, "key", &out)
+	if client.ErrorKind(err) != client.KindAuth {
+		t.Fatalf("Wanted error kind %d, got: %v\n", client.KindAuth, err)
+	}
+}
+
+func TestServerMount(t *testing.T) {
+	s, err := New("localhost", 5002, "", "", 0)
+	if err != nil {
+		t.Fatalf("problem starting server: %v", err)
+	}
+	go func() {
+		err := s.Start()
+		if err != nil {
+			t.Errorf("problem starting server: %v", err)
+		}
+	}()
+	defer s.Stop()
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(file.Name())
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	s.SetMountDir(dir)
+	outside, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s\n", err)
+	}
+	defer os.RemoveAll(outside)
+	c, err := client.New("localhost:5002", client.WithConfig(file.Name()))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	ctx := context.Background()
+	for _, name := range []string{"one", "two"} {
+		if err := c.Set(ctx, name, []byte(name+"-value")); err != nil {
+			t.Fatalf("unexpected error while setting %s: %v\n", name, err)
+		}
+		if err := c.Mount(ctx, name, client.PasswordField, dir+"/"+name); err != nil {
+			t.Fatalf("unexpected error while mounting %s: %v\n", name, err)
+		}
+	}
+	data, err := ioutil.ReadFile(dir + "/one")
+	if err != nil || string(data) != "one-value" {
+		t.Fatalf("Wanted: 'one-value', got: %s (%v)\n", data, err)
+	}
+	if err := c.Delete(ctx, "one"); err != nil {
+		t.Fatalf("unexpected error while deleting: %v\n", err)
+	}
+	if _, err := os.Stat(dir + "/one"); !os.IsNotExist(err) {
+		t.Fatalf("expected deleting the entry to remove its file, got: %v\n", err)
+	}
+	// The server deletes mounted files so it refuses any outside its
+	// mount directory
+	if err := c.Mount(ctx, "two", client.PasswordField, outside+"/two"); err == nil {
+		t.Fatalf("expected mounting outside the mount directory to fail\n")
+	}
+	if _, err := os.Stat(outside + "/two"); !os.IsNotExist(err) {
+		t.Fatalf("expected a refused mount to be removed, got: %v\n", err)
+	}
+	if err := os.Symlink(outside, dir+"/link"); err != nil {
+		t.Fatalf("unable to create symlink: %v\n", err)
+	}
+	if err := c.Mount(ctx, "two", client.PasswordField, dir+"/link/two"); err == nil {
+		t.Fatalf("expected mounting through a symlink out of the mount directory to fail\n")
+	}
+	if err := c.Mount(ctx, "missing", client.PasswordField, dir+"/missing"); client.ErrorKind(err) != client.KindNotSet {
+		t.Fatalf("Wanted error kind %d, got: %v\n", client.KindNotSet, err)
+	}
+	// An unusable mount directory isn't the same as a locked stash
+	s.SetMountDir(file.Name() + "/mounts")
+	if err := c.Mount(ctx, "two", client.PasswordField, dir+"/other"); client.ErrorKind(err) != client.KindOther {
+		t.Fatalf("Wanted error kind %d, got: %v\n", client.KindOther, err)
+	}
+	s.SetMountDir(dir)
+	s.Stop()
+	if _, err := os.Stat(dir + "/two"); !os.IsNotExist(err) {
+		t.Fatalf("expected stopping the server to remove mounted files, got: %v\n", err)
+	}
+}
+
+func TestServerMaxReads(t *testing.T) {
+	s, err := New("localhost", 5002, "", "", 0)
+	if err != nil {
+		t.Fatalf("problem starting server: %v", err)
+	}
+	go func() {
+		err := s.Start()
+		if err != nil {
+			t.Errorf("problem starting server: %v", err)
+		}
+	}()
+	defer s.Stop()
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(file.Name())
+	c, err := client.New("localhost:5002", client.WithConfig(file.Name()))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	ctx := context.Background()
+	if err := c.Set(ctx, "twice", []byte("value"), client.MaxReads(2)); err != nil {
+		t.Fatalf("unexpected error while setting: %v\n", err)
+	}
+	st, err := c.Status(ctx, "twice")
+	if err != nil || st.ReadsLeft != 2 {
+		t.Fatalf("Wanted 2 reads left, got: %d (%v)\n", st.ReadsLeft, err)
+	}
+	// Reading the entry to mount it could drop it along with its file
+	if err := c.Mount(ctx, "twice", client.PasswordField, os.TempDir()+"/twice"); err == nil {
+		t.Fatalf("expected mounting a read limited entry to fail\n")
+	}
+	if st, err := c.Status(ctx, "twice"); err != nil || st.ReadsLeft != 2 {
+		t.Fatalf("Wanted a refused mount not to count as a read, got: %d (%v)\n", st.ReadsLeft, err)
+	}
+	for i := 0; i < 2; i++ {
+		if value, err := c.Get(ctx, "twice"); err != nil || value != "value" {
+			t.Fatalf("Wanted: 'value', got: %s (%v)\n", value, err)
+		}
+	}
+	if _, err := c.Get(ctx, "twice"); client.ErrorKind(err) != client.KindNotSet {
+		t.Fatalf("Wanted error kind %d after the last read, got: %v\n", client.KindNotSet, err)
+	}
+}
+
+func TestServerBindPID(t *testing.T) {
+	s, err := New("localhost", 5002, "", "", 0)
+	if err != nil {
+		t.Fatalf("problem starting server: %v", err)
+	}
+	go func() {
+		err := s.Start()
+		if err != nil {
+			t.Errorf("problem starting server: %v", err)
+		}
+	}()
+	defer s.Stop()
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(file.Name())
+	c, err := client.New("localhost:5002", client.WithConfig(file.Name()))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	ctx := context.Background()
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("unable to start sleep: %v\n", err)
+	}
+	if err := c.Set(ctx, "bound", []byte("value"), client.BindPID(cmd.Process.Pid)); err != nil {
+		t.Fatalf("unexpected error while setting: %v\n", err)
+	}
+	if value, err := c.Get(ctx, "bound"); err != nil || value != "value" {
+		t.Fatalf("Wanted: 'value', got: %s (%v)\n", value, err)
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+	if _, err := c.Get(ctx, "bound"); client.ErrorKind(err) != client.KindNotSet {
+		t.Fatalf("Wanted error kind %d after the process exited, got: %v\n", client.KindNotSet, err)
+	}
+	if err := c.Set(ctx, "bound", []byte("value"), client.BindPID(cmd.Process.Pid)); err == nil {
+		t.Fatalf("expected binding to an exited process to fail\n")
+	}
+}
+
+func TestServerProcessStart(t *testing.T) {
+	start := processStart(os.Getpid())
+	if start == 0 {
+		t.Skip("process start times aren't available")
+	}
+	now := time.Now()
+	e := &entry{pid: os.Getpid(), pidStart: start}
+	if reason := e.stale(now); reason != "" {
+		t.Fatalf("Wanted the entry to be kept, got: %s\n", reason)
+	}
+	// A reused pid belongs to a process that started at another time
+	e.pidStart = start + 1
+	if reason := e.stale(now); reason == "" {
+		t.Fatalf("Wanted an entry bound to a reused pid to be dropped\n")
+	}
+}
+
+func TestServerHold(t *testing.T) {
+	s, err := New("localhost", 5002, "", "", 0)
+	if err != nil {
+		t.Fatalf("problem starting server: %v", err)
+	}
+	go func() {
+		err := s.Start()
+		if err != nil {
+			t.Errorf("problem starting server: %v", err)
+		}
+	}()
+	defer s.Stop()
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(file.Name())
+	c, err := client.New("localhost:5002", client.WithConfig(file.Name()))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := c.Hold(ctx, "held", []byte("value"))
+	if err != nil {
+		t.Fatalf("unexpected error while holding: %v\n", err)
+	}
+	if value, err := c.Get(context.Background(), "held"); err != nil || value != "value" {
+		t.Fatalf("Wanted: 'value', got: %s (%v)\n", value, err)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error after releasing the hold: %v\n", err)
+	}
+	// The server notices the stream has gone asynchronously
+	for i := 0; i < 10; i++ {
+		if _, err = c.Get(context.Background(), "held"); err != nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	if client.ErrorKind(err) != client.KindNotSet {
+		t.Fatalf("Wanted error kind %d after releasing the hold, got: %v\n", client.KindNotSet, err)
+	}
+}
+
+func TestServerNextExpiry(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 30, 0, 0, time.Local)
+	tests := []struct {
+		expiration time.Duration
+		hour       int
+		minute     int
+		want       time.Time
+	}{
+		{0, -1, 0, time.Time{}},
+		{time.Hour * 12, -1, 0, now.Add(time.Hour * 12)},
+		{0, 18, 0, time.Date(2019, 6, 1, 18, 0, 0, 0, time.Local)},
+		{0, 9, 15, time.Date(2019, 6, 2, 9, 15, 0, 0, time.Local)},
+		{time.Hour, 18, 0, now.Add(time.Hour)},
+		{time.Hour * 12, 18, 0, time.Date(2019, 6, 1, 18, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		s := &Server{expiration: tt.expiration, expireAt: -1}
+		if tt.hour >= 0 {
+			s.SetExpireAt(tt.hour, tt.minute)
+		}
+		if got := s.nextExpiry(now); !got.Equal(tt.want) {
+			t.Errorf("Wanted: %v, got: %v\n", tt.want, got)
+		}
+	}
+}
+
+func TestServerExpireAt(t *testing.T) {
+	s, err := New("localhost", 5002, "", "", 0)
+	if err != nil {
+		t.Fatalf("problem starting server: %v", err)
+	}
+	go func() {
+		err := s.Start()
+		if err != nil {
+			t.Errorf("problem starting server: %v", err)
+		}
+	}()
+	defer s.Stop()
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(file.Name())
+	c, err := client.New("localhost:5002", client.WithConfig(file.Name()))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	ctx := context.Background()
+	at := time.Now().Add(time.Second * 2).Truncate(time.Second)
+	if err := c.Set(ctx, "at", []byte("value"), client.ExpireAt(at), client.TTL(time.Hour)); err != nil {
+		t.Fatalf("unexpected error while setting: %v\n", err)
+	}
+	st, err := c.Status(ctx, "at")
+	if err != nil || !st.Expires.Equal(at) {
+		t.Fatalf("Wanted expiry at %v, got: %v (%v)\n", at, st.Expires, err)
+	}
+	time.Sleep(time.Until(at))
+	if _, err := c.Get(ctx, "at"); client.ErrorKind(err) != client.KindNotSet {
+		t.Fatalf("expected entry to have expired, got: %v\n", err)
+	}
+	if err := c.Set(ctx, "at", []byte("value"), client.ExpireAt(time.Now().Add(-time.Minute))); err == nil {
+		t.Fatalf("expected an expiry time in the past to be refused\n")
+	}
+}
+
+func TestServerLock(t *testing.T) {
+	s, err := New("localhost", 5002, "", "", 0)
+	if err != nil {
+		t.Fatalf("problem starting server: %v", err)
+	}
+	go func() {
+		err := s.Start()
+		if err != nil {
+			t.Errorf("problem starting server: %v", err)
+		}
+	}()
+	defer s.Stop()
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(file.Name())
+	c, err := client.New("localhost:5002", client.WithConfig(file.Name()))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	ctx := context.Background()
+	// Nothing can be locked by a client that hasn't stored anything
+	other, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(other.Name())
+	other.WriteString("other:saltandpasswordstring")
+	other.Close()
+	c2, err := client.New("localhost:5002", client.WithConfig(other.Name()))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	if err := c2.SetPIN(ctx, []byte("1234")); client.ErrorKind(err) != client.KindAuth {
+		t.Fatalf("Wanted error kind %d before anything is set, got: %v\n", client.KindAuth, err)
+	}
+	if err := c2.Lock(ctx, []byte("1234")); client.ErrorKind(err) != client.KindAuth {
+		t.Fatalf("Wanted error kind %d before anything is set, got: %v\n", client.KindAuth, err)
+	}
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	s.SetMountDir(dir)
+	if err := c.Set(ctx, "locked", []byte("value")); err != nil {
+		t.Fatalf("unexpected error while setting: %v\n", err)
+	}
+	if err := c.Mount(ctx, "locked", client.PasswordField, dir+"/locked"); err != nil {
+		t.Fatalf("unexpected error while mounting: %v\n", err)
+	}
+	if err := c.Lock(ctx, nil); err == nil {
+		t.Fatalf("expected locking without a PIN to fail\n")
+	}
+	if err := c.Lock(ctx, []byte("1234")); err != nil {
+		t.Fatalf("unexpected error while locking: %v\n", err)
+	}
+	if _, err := os.Stat(dir + "/locked"); !os.IsNotExist(err) {
+		t.Fatalf("expected locking to remove mounted files, got: %v\n", err)
+	}
+	if _, err := c.Get(ctx, "locked"); client.ErrorKind(err) != client.KindLocked {
+		t.Fatalf("Wanted error kind %d while locked, got: %v\n", client.KindLocked, err)
+	}
+	if err := c.Set(ctx, "other", []byte("value")); client.ErrorKind(err) != client.KindLocked {
+		t.Fatalf("Wanted error kind %d while locked, got: %v\n", client.KindLocked, err)
+	}
+	st, err := c.Status(ctx, "locked")
+	if err != nil || !st.Set || !st.Locked {
+		t.Fatalf("Wanted a locked entry, got: %+v (%v)\n", st, err)
+	}
+	if err := c.Unlock(ctx, []byte("4321")); client.ErrorKind(err) != client.KindAuth {
+		t.Fatalf("Wanted error kind %d for a wrong PIN, got: %v\n", client.KindAuth, err)
+	}
+	if err := c.Unlock(ctx, []byte("1234")); err != nil {
+		t.Fatalf("unexpected error while unlocking: %v\n", err)
+	}
+	if value, err := c.Get(ctx, "locked"); err != nil || value != "value" {
+		t.Fatalf("Wanted: 'value', got: %s (%v)\n", value, err)
+	}
+	// Too many wrong PINs drop everything
+	if err := c.Lock(ctx, nil); err != nil {
+		t.Fatalf("unexpected error while locking: %v\n", err)
+	}
+	for i := 0; i < maxUnlockAttempts; i++ {
+		c.Unlock(ctx, []byte("0000"))
+	}
+	if _, err := c.Get(ctx, "locked"); client.ErrorKind(err) != client.KindNotSet {
+		t.Fatalf("Wanted error kind %d after too many wrong PINs, got: %v\n", client.KindNotSet, err)
+	}
+}
+
+func TestServerIdleLock(t *testing.T) {
+	s, err := New("localhost", 5002, "", "", 0)
+	if err != nil {
+		t.Fatalf("problem starting server: %v", err)
+	}
+	s.SetLockAfter(time.Minute)
+	go func() {
+		err := s.Start()
+		if err != nil {
+			t.Errorf("problem starting server: %v", err)
+		}
+	}()
+	defer s.Stop()
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s\n", err)
+	}
+	defer os.Remove(file.Name())
+	c, err := client.New("localhost:5002", client.WithConfig(file.Name()))
+	if err != nil {
+		t.Fatalf("unexpected error while getting client: %v\n", err)
+	}
+	ctx := context.Background()
+	if err := c.Set(ctx, "idle", []byte("value")); err != nil {
+		t.Fatalf("unexpected error while setting: %v\n", err)
+	}
+	// Nothing is locked automatically until a PIN is set
+	s.vault.mux.Lock()
+	s.vault.lastUsed = time.Now().Round(0).Add(-time.Hour)
+	s.vault.mux.Unlock()
+	s.vault.check(time.Now())
+	if st, err := c.Status(ctx, "idle"); err != nil || st.Locked {
+		t.Fatalf("Wanted an unlocked entry without a PIN, got: %+v (%v)\n", st, err)
+	}
+	if err := c.SetPIN(ctx, []byte("1234")); err != nil {
+		t.Fatalf("unexpected error while setting the PIN: %v\n", err)
+	}
+	// Setting the PIN counts as using the vault
+	s.vault.check(time.Now())
+	if st, err := c.Status(ctx, "idle"); err != nil || st.Locked {
+		t.Fatalf("Wanted an unlocked entry before the vault is idle, got: %+v (%v)\n", st, err)
+	}
+	s.vault.mux.Lock()
+	s.vault.lastUsed = time.Now().Round(0).Add(-time.Minute)
+	s.vault.mux.Unlock()
+	s.vault.check(time.Now())
+	if st, err := c.Status(ctx, "idle"); err != nil || !st.Locked {
+		t.Fatalf("Wanted the idle vault to be locked, got: %+v (%v)\n", st, err)
+	}
+	if err := c.Unlock(ctx, []byte("1234")); err != nil {
+		t.Fatalf("unexpected error while unlocking: %v\n", err)
+	}
+	if value, err := c.Get(ctx, "idle"); err != nil || value != "value" {
+		t.Fatalf("Wanted: 'value', got: %s (%v)\n", value, err)
+	}
+}
+
+func TestServerJump(t *testing.T) {
+	last := time.Date(2019, 6, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		wall    time.Duration
+		elapsed time.Duration
+		suspend bool
+	}{
+		// An ordinary tick
+		{time.Second, time.Second, false},
+		// A small adjustment by NTP
+		{time.Second * 3, time.Second, false},
+		// Resumed after two hours
+		{time.Hour * 2, time.Second, true},
+		// The clock set back
+		{-time.Hour, time.Second, false},
+	}
+	for _, tt := range tests {
+		got := jump(last, last.Add(tt.wall), tt.elapsed)
+		if got != tt.wall-tt.elapsed {
+			t.Errorf("Wanted a jump of %s, got: %s\n", tt.wall-tt.elapsed, got)
+		}
+		if suspend := got > maxClockJump; suspend != tt.suspend {
+			t.Errorf("%s on the wall clock: wanted suspended to be %v\n", tt.wall, tt.suspend)
+		}
+	}
+}
+
+func TestServerStopClock(t *testing.T) {
+	s, err := New("localhost", 5002, "", "", 0)
+	if err != nil {
+		t.Fatalf("problem starting server: %v", err)
+	}
+	// The server is never started so nothing else closes its listener
+	defer s.l.Close()
+	stopped := make(chan struct{})
+	go func() {
+		s.watchClock()
+		close(stopped)
+	}()
+	s.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("watchClock didn't stop with the server\n")
+	}
+	// Stopping twice is harmless
+	s.Stop()
 }
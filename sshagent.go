@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/walkert/stash/client"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// sshEntryName returns the name of the entry holding the private key known
+// to the agent by comment.
+func sshEntryName(comment string) string {
+	return "ssh:" + comment
+}
+
+// decryptKey returns pemBytes as an unencrypted PEM block, asking for the
+// passphrase if the key is encrypted. The stash encrypts it anyway and the
+// agent can't ask for a passphrase every time it signs.
+func decryptKey(pemBytes []byte, path string, ask func(prompt string, mask bool) ([]byte, error)) ([]byte, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no private key found in %s", path)
+	}
+	_, err := ssh.ParseRawPrivateKey(pemBytes)
+	if err == nil {
+		return pemBytes, nil
+	}
+	if _, ok := err.(*ssh.PassphraseMissingError); !ok {
+		return nil, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	passphrase, err := ask(fmt.Sprintf("Enter passphrase for %s: ", path), true)
+	if err != nil {
+		return nil, err
+	}
+	var key []byte
+	if x509.IsEncryptedPEMBlock(block) {
+		// Legacy PEM keys keep their format, which also covers DSA keys
+		der, err := x509.DecryptPEMBlock(block, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt %s: %v", path, err)
+		}
+		key = pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der})
+	} else {
+		// OpenSSH keys can't be written back out so they're stored as
+		// PKCS#8 instead
+		raw, err := ssh.ParseRawPrivateKeyWithPassphrase(pemBytes, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt %s: %v", path, err)
+		}
+		if k, ok := raw.(*ed25519.PrivateKey); ok {
+			raw = *k
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert %s: %v", path, err)
+		}
+		key = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+	if _, err := ssh.ParseRawPrivateKey(key); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	return key, nil
+}
+
+// keyStore stores private keys. Unlike secretStore it doesn't apply the
+// password policies, which make no sense for keys.
+type keyStore interface {
+	Upload(ctx context.Context, name string, r io.Reader, opts ...client.SetOption) error
+}
+
+// sshAdd stores the private key at path for the agent, using the path as
+// its comment just like ssh-add.
+func sshAdd(ctx context.Context, store keyStore, path string, ask func(prompt string, mask bool) ([]byte, error), opts ...client.SetOption) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	key, err := decryptKey(data, path, ask)
+	if err != nil {
+		return err
+	}
+	return store.Upload(ctx, sshEntryName(path), bytes.NewReader(key), opts...)
+}
+
+// stashAgent is an SSH agent whose keys live in the stash. Keys are fetched
+// on every request so they disappear from the agent as soon as their
+// entries expire.
+type stashAgent struct {
+	ctx   context.Context
+	store secretStore
+}
+
+// keyring loads every key in the stash into an in-memory agent. It also
+// returns the entry holding each key, indexed by its public key. Every key
+// is fetched for each request, so each one counts as a read of every entry;
+// that's why ssh-add refuses --max-reads.
+func (a *stashAgent) keyring() (agent.ExtendedAgent, map[string]string, error) {
+	names, err := a.store.List(a.ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The keyring also supports the flags needed for SHA-2 RSA signatures
+	keyring := agent.NewKeyring().(agent.ExtendedAgent)
+	entries := map[string]string{}
+	for _, name := range names {
+		if !strings.HasPrefix(name, sshEntryName("")) {
+			continue
+		}
+		value, err := a.store.Get(a.ctx, name)
+		if err != nil {
+			// The entry may have expired since it was listed
+			continue
+		}
+		key, err := ssh.ParseRawPrivateKey([]byte(value))
+		if err != nil {
+			log.Debugf("Ignoring %q: %v\n", name, err)
+			continue
+		}
+		signer, err := ssh.NewSignerFromKey(key)
+		if err != nil {
+			log.Debugf("Ignoring %q: %v\n", name, err)
+			continue
+		}
+		comment := strings.TrimPrefix(name, sshEntryName(""))
+		if err := keyring.Add(agent.AddedKey{PrivateKey: key, Comment: comment}); err != nil {
+			log.Debugf("Ignoring %q: %v\n", name, err)
+			continue
+		}
+		entries[string(signer.PublicKey().Marshal())] = name
+	}
+	return keyring, entries, nil
+}
+
+func (a *stashAgent) List() ([]*agent.Key, error) {
+	keyring, _, err := a.keyring()
+	if err != nil {
+		return nil, err
+	}
+	return keyring.List()
+}
+
+func (a *stashAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	keyring, _, err := a.keyring()
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Sign(key, data)
+}
+
+func (a *stashAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	keyring, _, err := a.keyring()
+	if err != nil {
+		return nil, err
+	}
+	return keyring.SignWithFlags(key, data, flags)
+}
+
+func (a *stashAgent) Extension(extensionType string, contents []byte) ([]byte, error) {
+	return nil, agent.ErrExtensionUnsupported
+}
+
+func (a *stashAgent) Signers() ([]ssh.Signer, error) {
+	keyring, _, err := a.keyring()
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Signers()
+}
+
+// Add is refused since keys added by ssh-add would bypass the stash's
+// expiration. 'stash ssh-add' is used instead.
+func (a *stashAgent) Add(key agent.AddedKey) error {
+	return fmt.Errorf("keys must be added with 'stash ssh-add'")
+}
+
+func (a *stashAgent) Remove(key ssh.PublicKey) error {
+	_, entries, err := a.keyring()
+	if err != nil {
+		return err
+	}
+	name, ok := entries[string(key.Marshal())]
+	if !ok {
+		return fmt.Errorf("key not found")
+	}
+	return a.store.Delete(a.ctx, name)
+}
+
+func (a *stashAgent) RemoveAll() error {
+	_, entries, err := a.keyring()
+	if err != nil {
+		return err
+	}
+	for _, name := range entries {
+		if err := a.store.Delete(a.ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// locker is implemented by stores that can be locked with a PIN, such as
+// the client.
+type locker interface {
+	Lock(ctx context.Context, pin []byte) error
+	Unlock(ctx context.Context, pin []byte) error
+}
+
+// Lock locks the whole stash using passphrase as its PIN, so 'ssh-add -x'
+// locks every other secret along with the keys.
+func (a *stashAgent) Lock(passphrase []byte) error {
+	l, ok := a.store.(locker)
+	if !ok {
+		return fmt.Errorf("locking isn't supported")
+	}
+	return l.Lock(a.ctx, passphrase)
+}
+
+func (a *stashAgent) Unlock(passphrase []byte) error {
+	l, ok := a.store.(locker)
+	if !ok {
+		return fmt.Errorf("locking isn't supported")
+	}
+	return l.Unlock(a.ctx, passphrase)
+}
+
+// startAgent starts the agent in the background and prints the commands
+// that point ssh at it, like ssh-agent does, once it's listening.
+func startAgent(path string) error {
+	if path == "" {
+		return fmt.Errorf("no --socket given")
+	}
+	pid, err := startDaemon()
+	if err != nil {
+		return fmt.Errorf("unable to start ssh-agent in daemon mode: %v", err)
+	}
+	for deadline := time.Now().Add(timeout); ; time.Sleep(time.Millisecond * 50) {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("ssh-agent with pid %d didn't start listening on %s", pid, path)
+		}
+	}
+	fmt.Printf("SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", path)
+	fmt.Printf("echo Agent pid %d;\n", pid)
+	return nil
+}
+
+// serveAgent listens on the unix socket at path and serves the SSH agent
+// protocol until the listener fails.
+func serveAgent(ctx context.Context, store secretStore, path string) error {
+	if path == "" {
+		return fmt.Errorf("no --socket given")
+	}
+	// Replace a socket left behind by an agent that's no longer running
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s exists and isn't a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return fmt.Errorf("%s is already in use", path)
+		}
+		os.Remove(path)
+	}
+	// Only the owner may connect to the socket
+	mask := syscall.Umask(0177)
+	l, err := net.Listen("unix", path)
+	syscall.Umask(mask)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %v", path, err)
+	}
+	defer l.Close()
+	fmt.Printf("SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", path)
+	a := &stashAgent{ctx: ctx, store: store}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return fmt.Errorf("unable to accept connection: %v", err)
+		}
+		go func() {
+			defer conn.Close()
+			if err := agent.ServeAgent(a, conn); err != nil && err != io.EOF {
+				log.Debugf("Agent connection closed: %v\n", err)
+			}
+		}()
+	}
+}
@@ -22,8 +22,265 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+type Chunk struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Data                 []byte   `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	Ttl                  int64    `protobuf:"varint,3,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	MaxReads             int64    `protobuf:"varint,4,opt,name=max_reads,json=maxReads,proto3" json:"max_reads,omitempty"`
+	BindPid              int64    `protobuf:"varint,5,opt,name=bind_pid,json=bindPid,proto3" json:"bind_pid,omitempty"`
+	ExpiresAt            int64    `protobuf:"varint,6,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Chunk) Reset()         { *m = Chunk{} }
+func (m *Chunk) String() string { return proto.CompactTextString(m) }
+func (*Chunk) ProtoMessage()    {}
+func (*Chunk) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b21642789e59141a, []int{0}
+}
+
+func (m *Chunk) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Chunk.Unmarshal(m, b)
+}
+func (m *Chunk) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Chunk.Marshal(b, m, deterministic)
+}
+func (m *Chunk) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Chunk.Merge(m, src)
+}
+func (m *Chunk) XXX_Size() int {
+	return xxx_messageInfo_Chunk.Size(m)
+}
+func (m *Chunk) XXX_DiscardUnknown() {
+	xxx_messageInfo_Chunk.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Chunk proto.InternalMessageInfo
+
+func (m *Chunk) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Chunk) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *Chunk) GetTtl() int64 {
+	if m != nil {
+		return m.Ttl
+	}
+	return 0
+}
+
+func (m *Chunk) GetMaxReads() int64 {
+	if m != nil {
+		return m.MaxReads
+	}
+	return 0
+}
+
+func (m *Chunk) GetBindPid() int64 {
+	if m != nil {
+		return m.BindPid
+	}
+	return 0
+}
+
+func (m *Chunk) GetExpiresAt() int64 {
+	if m != nil {
+		return m.ExpiresAt
+	}
+	return 0
+}
+
+type Entry struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Entry) Reset()         { *m = Entry{} }
+func (m *Entry) String() string { return proto.CompactTextString(m) }
+func (*Entry) ProtoMessage()    {}
+func (*Entry) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b21642789e59141a, []int{1}
+}
+
+func (m *Entry) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Entry.Unmarshal(m, b)
+}
+func (m *Entry) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Entry.Marshal(b, m, deterministic)
+}
+func (m *Entry) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Entry.Merge(m, src)
+}
+func (m *Entry) XXX_Size() int {
+	return xxx_messageInfo_Entry.Size(m)
+}
+func (m *Entry) XXX_DiscardUnknown() {
+	xxx_messageInfo_Entry.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Entry proto.InternalMessageInfo
+
+func (m *Entry) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+type EntryList struct {
+	Entries              []*Entry `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *EntryList) Reset()         { *m = EntryList{} }
+func (m *EntryList) String() string { return proto.CompactTextString(m) }
+func (*EntryList) ProtoMessage()    {}
+func (*EntryList) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b21642789e59141a, []int{2}
+}
+
+func (m *EntryList) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_EntryList.Unmarshal(m, b)
+}
+func (m *EntryList) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_EntryList.Marshal(b, m, deterministic)
+}
+func (m *EntryList) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_EntryList.Merge(m, src)
+}
+func (m *EntryList) XXX_Size() int {
+	return xxx_messageInfo_EntryList.Size(m)
+}
+func (m *EntryList) XXX_DiscardUnknown() {
+	xxx_messageInfo_EntryList.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_EntryList proto.InternalMessageInfo
+
+func (m *EntryList) GetEntries() []*Entry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+type Field struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value                []byte   `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Field) Reset()         { *m = Field{} }
+func (m *Field) String() string { return proto.CompactTextString(m) }
+func (*Field) ProtoMessage()    {}
+func (*Field) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b21642789e59141a, []int{3}
+}
+
+func (m *Field) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Field.Unmarshal(m, b)
+}
+func (m *Field) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Field.Marshal(b, m, deterministic)
+}
+func (m *Field) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Field.Merge(m, src)
+}
+func (m *Field) XXX_Size() int {
+	return xxx_messageInfo_Field.Size(m)
+}
+func (m *Field) XXX_DiscardUnknown() {
+	xxx_messageInfo_Field.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Field proto.InternalMessageInfo
+
+func (m *Field) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Field) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+type Mount struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Path                 string   `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Mount) Reset()         { *m = Mount{} }
+func (m *Mount) String() string { return proto.CompactTextString(m) }
+func (*Mount) ProtoMessage()    {}
+func (*Mount) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b21642789e59141a, []int{4}
+}
+
+func (m *Mount) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Mount.Unmarshal(m, b)
+}
+func (m *Mount) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Mount.Marshal(b, m, deterministic)
+}
+func (m *Mount) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Mount.Merge(m, src)
+}
+func (m *Mount) XXX_Size() int {
+	return xxx_messageInfo_Mount.Size(m)
+}
+func (m *Mount) XXX_DiscardUnknown() {
+	xxx_messageInfo_Mount.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Mount proto.InternalMessageInfo
+
+func (m *Mount) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Mount) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
 type Payload struct {
 	Password             []byte   `protobuf:"bytes,1,opt,name=password,proto3" json:"password,omitempty"`
+	Name                 string   `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Ttl                  int64    `protobuf:"varint,3,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	Fields               []*Field `protobuf:"bytes,4,rep,name=fields,proto3" json:"fields,omitempty"`
+	MaxReads             int64    `protobuf:"varint,5,opt,name=max_reads,json=maxReads,proto3" json:"max_reads,omitempty"`
+	BindPid              int64    `protobuf:"varint,6,opt,name=bind_pid,json=bindPid,proto3" json:"bind_pid,omitempty"`
+	ExpiresAt            int64    `protobuf:"varint,7,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -33,7 +290,7 @@ func (m *Payload) Reset()         { *m = Payload{} }
 func (m *Payload) String() string { return proto.CompactTextString(m) }
 func (*Payload) ProtoMessage()    {}
 func (*Payload) Descriptor() ([]byte, []int) {
-	return fileDescriptor_b21642789e59141a, []int{0}
+	return fileDescriptor_b21642789e59141a, []int{5}
 }
 
 func (m *Payload) XXX_Unmarshal(b []byte) error {
@@ -61,6 +318,150 @@ func (m *Payload) GetPassword() []byte {
 	return nil
 }
 
+func (m *Payload) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Payload) GetTtl() int64 {
+	if m != nil {
+		return m.Ttl
+	}
+	return 0
+}
+
+func (m *Payload) GetFields() []*Field {
+	if m != nil {
+		return m.Fields
+	}
+	return nil
+}
+
+func (m *Payload) GetMaxReads() int64 {
+	if m != nil {
+		return m.MaxReads
+	}
+	return 0
+}
+
+func (m *Payload) GetBindPid() int64 {
+	if m != nil {
+		return m.BindPid
+	}
+	return 0
+}
+
+func (m *Payload) GetExpiresAt() int64 {
+	if m != nil {
+		return m.ExpiresAt
+	}
+	return 0
+}
+
+type Pin struct {
+	Pin                  []byte   `protobuf:"bytes,1,opt,name=pin,proto3" json:"pin,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Pin) Reset()         { *m = Pin{} }
+func (m *Pin) String() string { return proto.CompactTextString(m) }
+func (*Pin) ProtoMessage()    {}
+func (*Pin) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b21642789e59141a, []int{6}
+}
+
+func (m *Pin) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Pin.Unmarshal(m, b)
+}
+func (m *Pin) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Pin.Marshal(b, m, deterministic)
+}
+func (m *Pin) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Pin.Merge(m, src)
+}
+func (m *Pin) XXX_Size() int {
+	return xxx_messageInfo_Pin.Size(m)
+}
+func (m *Pin) XXX_DiscardUnknown() {
+	xxx_messageInfo_Pin.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Pin proto.InternalMessageInfo
+
+func (m *Pin) GetPin() []byte {
+	if m != nil {
+		return m.Pin
+	}
+	return nil
+}
+
+type Status struct {
+	Set                  bool     `protobuf:"varint,1,opt,name=set,proto3" json:"set,omitempty"`
+	Expires              int64    `protobuf:"varint,2,opt,name=expires,proto3" json:"expires,omitempty"`
+	ReadsLeft            int64    `protobuf:"varint,3,opt,name=reads_left,json=readsLeft,proto3" json:"reads_left,omitempty"`
+	Locked               bool     `protobuf:"varint,4,opt,name=locked,proto3" json:"locked,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Status) Reset()         { *m = Status{} }
+func (m *Status) String() string { return proto.CompactTextString(m) }
+func (*Status) ProtoMessage()    {}
+func (*Status) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b21642789e59141a, []int{7}
+}
+
+func (m *Status) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Status.Unmarshal(m, b)
+}
+func (m *Status) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Status.Marshal(b, m, deterministic)
+}
+func (m *Status) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Status.Merge(m, src)
+}
+func (m *Status) XXX_Size() int {
+	return xxx_messageInfo_Status.Size(m)
+}
+func (m *Status) XXX_DiscardUnknown() {
+	xxx_messageInfo_Status.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Status proto.InternalMessageInfo
+
+func (m *Status) GetSet() bool {
+	if m != nil {
+		return m.Set
+	}
+	return false
+}
+
+func (m *Status) GetExpires() int64 {
+	if m != nil {
+		return m.Expires
+	}
+	return 0
+}
+
+func (m *Status) GetReadsLeft() int64 {
+	if m != nil {
+		return m.ReadsLeft
+	}
+	return 0
+}
+
+func (m *Status) GetLocked() bool {
+	if m != nil {
+		return m.Locked
+	}
+	return false
+}
+
 type Void struct {
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -71,7 +472,7 @@ func (m *Void) Reset()         { *m = Void{} }
 func (m *Void) String() string { return proto.CompactTextString(m) }
 func (*Void) ProtoMessage()    {}
 func (*Void) Descriptor() ([]byte, []int) {
-	return fileDescriptor_b21642789e59141a, []int{1}
+	return fileDescriptor_b21642789e59141a, []int{8}
 }
 
 func (m *Void) XXX_Unmarshal(b []byte) error {
@@ -93,23 +494,55 @@ func (m *Void) XXX_DiscardUnknown() {
 var xxx_messageInfo_Void proto.InternalMessageInfo
 
 func init() {
+	proto.RegisterType((*Chunk)(nil), "stashproto.Chunk")
+	proto.RegisterType((*Entry)(nil), "stashproto.Entry")
+	proto.RegisterType((*EntryList)(nil), "stashproto.EntryList")
+	proto.RegisterType((*Field)(nil), "stashproto.Field")
+	proto.RegisterType((*Mount)(nil), "stashproto.Mount")
 	proto.RegisterType((*Payload)(nil), "stashproto.Payload")
+	proto.RegisterType((*Pin)(nil), "stashproto.Pin")
+	proto.RegisterType((*Status)(nil), "stashproto.Status")
 	proto.RegisterType((*Void)(nil), "stashproto.Void")
 }
 
 func init() { proto.RegisterFile("stash.proto", fileDescriptor_b21642789e59141a) }
 
 var fileDescriptor_b21642789e59141a = []byte{
-	// 131 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x2e, 0x2e, 0x49, 0x2c,
-	0xce, 0xd0, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x02, 0x73, 0xc0, 0x6c, 0x25, 0x55, 0x2e,
-	0xf6, 0x80, 0xc4, 0xca, 0x9c, 0xfc, 0xc4, 0x14, 0x21, 0x29, 0x2e, 0x8e, 0x82, 0xc4, 0xe2, 0xe2,
-	0xf2, 0xfc, 0xa2, 0x14, 0x09, 0x46, 0x05, 0x46, 0x0d, 0x9e, 0x20, 0x38, 0x5f, 0x89, 0x8d, 0x8b,
-	0x25, 0x2c, 0x3f, 0x33, 0xc5, 0x28, 0x9d, 0x8b, 0x35, 0x18, 0xa4, 0x59, 0x48, 0x8f, 0x8b, 0xd9,
-	0x3d, 0xb5, 0x44, 0x48, 0x40, 0x0f, 0x61, 0x96, 0x1e, 0x48, 0x85, 0x94, 0x30, 0xb2, 0x08, 0xd4,
-	0x68, 0x25, 0x06, 0x90, 0xfa, 0xe0, 0xd4, 0x12, 0x21, 0x6c, 0xb2, 0x52, 0x18, 0x86, 0x28, 0x31,
-	0x24, 0xb1, 0x81, 0x79, 0xc6, 0x80, 0x00, 0x00, 0x00, 0xff, 0xff, 0x86, 0xa6, 0x2d, 0xc6, 0xb9,
-	0x00, 0x00, 0x00,
+	// 541 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x53, 0x4d, 0x6f, 0xda, 0x4c,
+	0x10, 0xc6, 0xf1, 0x07, 0xf6, 0x24, 0xd2, 0x9b, 0x77, 0xfb, 0xe5, 0x12, 0x55, 0x42, 0x7b, 0x72,
+	0x15, 0x15, 0x42, 0xda, 0x43, 0xaf, 0x55, 0xd3, 0x8f, 0x03, 0x95, 0xd0, 0xa2, 0xf4, 0x8a, 0x36,
+	0xd9, 0x45, 0xac, 0x30, 0x6b, 0xcb, 0x5e, 0x1a, 0xf2, 0x4f, 0xfa, 0xa7, 0x7a, 0xed, 0xef, 0xa9,
+	0x76, 0x30, 0x14, 0x6a, 0x27, 0xe2, 0x36, 0xcf, 0x33, 0x33, 0xde, 0x79, 0xe6, 0x19, 0xc3, 0x71,
+	0x69, 0x78, 0x39, 0xeb, 0xe5, 0x45, 0x66, 0x32, 0x02, 0x08, 0x30, 0xa6, 0x3f, 0x1d, 0xf0, 0x3f,
+	0xce, 0x96, 0x7a, 0x4e, 0x08, 0x78, 0x9a, 0x2f, 0x64, 0xec, 0x74, 0x9d, 0x24, 0x62, 0x18, 0x5b,
+	0x4e, 0x70, 0xc3, 0xe3, 0xa3, 0xae, 0x93, 0x9c, 0x30, 0x8c, 0xc9, 0x29, 0xb8, 0xc6, 0xa4, 0xb1,
+	0xdb, 0x75, 0x12, 0x97, 0xd9, 0x90, 0x9c, 0x41, 0xb4, 0xe0, 0xab, 0x49, 0x21, 0xb9, 0x28, 0x63,
+	0x0f, 0xf9, 0x70, 0xc1, 0x57, 0xcc, 0x62, 0xf2, 0x12, 0xc2, 0x1b, 0xa5, 0xc5, 0x24, 0x57, 0x22,
+	0xf6, 0x31, 0xd7, 0xb6, 0x78, 0xa4, 0x04, 0x79, 0x05, 0x20, 0x57, 0xb9, 0x2a, 0x64, 0x39, 0xe1,
+	0x26, 0x0e, 0x30, 0x19, 0x55, 0xcc, 0x07, 0x43, 0xcf, 0xc0, 0xff, 0xa4, 0x4d, 0x71, 0xdf, 0x34,
+	0x19, 0x7d, 0x0f, 0x11, 0x26, 0x87, 0xaa, 0x34, 0xe4, 0x1c, 0xda, 0x52, 0x9b, 0x42, 0xc9, 0x32,
+	0x76, 0xba, 0x6e, 0x72, 0x7c, 0xf9, 0x7f, 0xef, 0xaf, 0xc4, 0x1e, 0xd6, 0xb1, 0x4d, 0x05, 0x1d,
+	0x80, 0xff, 0x59, 0xc9, 0x54, 0x34, 0x0a, 0x7e, 0x0a, 0xfe, 0x0f, 0x9e, 0x2e, 0x65, 0xa5, 0x78,
+	0x0d, 0x68, 0x1f, 0xfc, 0x6f, 0xd9, 0x52, 0x9b, 0x87, 0x76, 0x94, 0x73, 0x33, 0xc3, 0x8e, 0x88,
+	0x61, 0x4c, 0x7f, 0x39, 0xd0, 0x1e, 0xf1, 0xfb, 0x34, 0xe3, 0x82, 0x74, 0x20, 0xcc, 0x79, 0x59,
+	0xde, 0x65, 0x85, 0xc0, 0xbe, 0x13, 0xb6, 0xc5, 0xdb, 0xef, 0x1d, 0xed, 0x7c, 0xaf, 0xbe, 0xdf,
+	0xd7, 0x10, 0x4c, 0xed, 0xc4, 0x76, 0xb9, 0x35, 0x75, 0xa8, 0x85, 0x55, 0x05, 0xfb, 0x56, 0xf8,
+	0x8f, 0x58, 0x11, 0x3c, 0x66, 0x45, 0xfb, 0x5f, 0x2b, 0x5e, 0x80, 0x3b, 0x52, 0xda, 0x8e, 0x96,
+	0x2b, 0x5d, 0xa9, 0xb0, 0x21, 0x9d, 0x43, 0x30, 0x36, 0xdc, 0x2c, 0x4b, 0x9b, 0x2b, 0xa5, 0xc1,
+	0x5c, 0xc8, 0x6c, 0x48, 0x62, 0x68, 0x57, 0x5f, 0x40, 0x7d, 0x2e, 0xdb, 0x40, 0xfb, 0x1a, 0x4e,
+	0x38, 0x49, 0xe5, 0xd4, 0x54, 0x4a, 0x23, 0x64, 0x86, 0x72, 0x6a, 0xc8, 0x73, 0x08, 0xd2, 0xec,
+	0x76, 0x2e, 0x05, 0x1e, 0x53, 0xc8, 0x2a, 0x44, 0x03, 0xf0, 0xbe, 0x67, 0x4a, 0x5c, 0xfe, 0xf6,
+	0xc0, 0x1f, 0xdb, 0x0d, 0x90, 0x3e, 0x04, 0x57, 0x32, 0x95, 0x46, 0x92, 0xba, 0xe3, 0x9d, 0xd3,
+	0x5d, 0xca, 0x36, 0xd2, 0x16, 0x79, 0x07, 0xe1, 0x55, 0x76, 0xa7, 0xd1, 0x98, 0x86, 0x96, 0x3d,
+	0x0a, 0x7f, 0x0b, 0xda, 0xba, 0x70, 0x48, 0x1f, 0xdc, 0x2f, 0xd2, 0x34, 0x35, 0x3c, 0xd9, 0xa5,
+	0x2a, 0xc7, 0x69, 0x8b, 0x0c, 0xc0, 0xfb, 0x9a, 0xa5, 0x82, 0x34, 0xa5, 0x9b, 0xe6, 0xba, 0x70,
+	0x6c, 0x0b, 0xde, 0x72, 0x2d, 0xdb, 0x79, 0x56, 0x7b, 0xd6, 0x16, 0xd2, 0x16, 0x39, 0x07, 0x6f,
+	0x98, 0xdd, 0xce, 0xc9, 0x7f, 0x7b, 0xaf, 0x28, 0xdd, 0xa8, 0xbc, 0xb7, 0xb9, 0xe1, 0x3d, 0x15,
+	0x48, 0x3d, 0x50, 0xef, 0x8e, 0xa5, 0x39, 0x58, 0x01, 0x79, 0x03, 0xc1, 0x58, 0x1a, 0x7b, 0x25,
+	0x07, 0x8d, 0x33, 0xd8, 0x1e, 0x4e, 0xc3, 0x56, 0xc9, 0x2e, 0xb5, 0x2e, 0x5b, 0xbf, 0x70, 0xad,
+	0xd3, 0x83, 0x05, 0x0f, 0x20, 0xb8, 0xce, 0xeb, 0x46, 0xa3, 0xab, 0x4d, 0x0d, 0x89, 0x73, 0x13,
+	0x20, 0x7e, 0xfb, 0x67, 0x00, 0xb0, 0x7b, 0x35, 0x8c, 0x2e, 0x05, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -124,8 +557,18 @@ const _ = grpc.SupportPackageIsVersion4
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type StashClient interface {
-	Get(ctx context.Context, in *Void, opts ...grpc.CallOption) (*Payload, error)
+	Delete(ctx context.Context, in *Entry, opts ...grpc.CallOption) (*Void, error)
+	Download(ctx context.Context, in *Entry, opts ...grpc.CallOption) (Stash_DownloadClient, error)
+	Get(ctx context.Context, in *Entry, opts ...grpc.CallOption) (*Payload, error)
+	Hold(ctx context.Context, in *Payload, opts ...grpc.CallOption) (Stash_HoldClient, error)
+	List(ctx context.Context, in *Void, opts ...grpc.CallOption) (*EntryList, error)
+	Lock(ctx context.Context, in *Pin, opts ...grpc.CallOption) (*Void, error)
+	Mount(ctx context.Context, in *Mount, opts ...grpc.CallOption) (*Void, error)
 	Set(ctx context.Context, in *Payload, opts ...grpc.CallOption) (*Void, error)
+	SetPin(ctx context.Context, in *Pin, opts ...grpc.CallOption) (*Void, error)
+	Status(ctx context.Context, in *Entry, opts ...grpc.CallOption) (*Status, error)
+	Unlock(ctx context.Context, in *Pin, opts ...grpc.CallOption) (*Void, error)
+	Upload(ctx context.Context, opts ...grpc.CallOption) (Stash_UploadClient, error)
 }
 
 type stashClient struct {
@@ -136,7 +579,48 @@ func NewStashClient(cc *grpc.ClientConn) StashClient {
 	return &stashClient{cc}
 }
 
-func (c *stashClient) Get(ctx context.Context, in *Void, opts ...grpc.CallOption) (*Payload, error) {
+func (c *stashClient) Delete(ctx context.Context, in *Entry, opts ...grpc.CallOption) (*Void, error) {
+	out := new(Void)
+	err := c.cc.Invoke(ctx, "/stashproto.Stash/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *stashClient) Download(ctx context.Context, in *Entry, opts ...grpc.CallOption) (Stash_DownloadClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Stash_serviceDesc.Streams[0], "/stashproto.Stash/Download", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &stashDownloadClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Stash_DownloadClient interface {
+	Recv() (*Chunk, error)
+	grpc.ClientStream
+}
+
+type stashDownloadClient struct {
+	grpc.ClientStream
+}
+
+func (x *stashDownloadClient) Recv() (*Chunk, error) {
+	m := new(Chunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *stashClient) Get(ctx context.Context, in *Entry, opts ...grpc.CallOption) (*Payload, error) {
 	out := new(Payload)
 	err := c.cc.Invoke(ctx, "/stashproto.Stash/Get", in, out, opts...)
 	if err != nil {
@@ -145,6 +629,65 @@ func (c *stashClient) Get(ctx context.Context, in *Void, opts ...grpc.CallOption
 	return out, nil
 }
 
+func (c *stashClient) Hold(ctx context.Context, in *Payload, opts ...grpc.CallOption) (Stash_HoldClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Stash_serviceDesc.Streams[1], "/stashproto.Stash/Hold", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &stashHoldClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Stash_HoldClient interface {
+	Recv() (*Void, error)
+	grpc.ClientStream
+}
+
+type stashHoldClient struct {
+	grpc.ClientStream
+}
+
+func (x *stashHoldClient) Recv() (*Void, error) {
+	m := new(Void)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *stashClient) List(ctx context.Context, in *Void, opts ...grpc.CallOption) (*EntryList, error) {
+	out := new(EntryList)
+	err := c.cc.Invoke(ctx, "/stashproto.Stash/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *stashClient) Lock(ctx context.Context, in *Pin, opts ...grpc.CallOption) (*Void, error) {
+	out := new(Void)
+	err := c.cc.Invoke(ctx, "/stashproto.Stash/Lock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *stashClient) Mount(ctx context.Context, in *Mount, opts ...grpc.CallOption) (*Void, error) {
+	out := new(Void)
+	err := c.cc.Invoke(ctx, "/stashproto.Stash/Mount", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *stashClient) Set(ctx context.Context, in *Payload, opts ...grpc.CallOption) (*Void, error) {
 	out := new(Void)
 	err := c.cc.Invoke(ctx, "/stashproto.Stash/Set", in, out, opts...)
@@ -154,18 +697,128 @@ func (c *stashClient) Set(ctx context.Context, in *Payload, opts ...grpc.CallOpt
 	return out, nil
 }
 
+func (c *stashClient) SetPin(ctx context.Context, in *Pin, opts ...grpc.CallOption) (*Void, error) {
+	out := new(Void)
+	err := c.cc.Invoke(ctx, "/stashproto.Stash/SetPin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *stashClient) Status(ctx context.Context, in *Entry, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/stashproto.Stash/Status", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *stashClient) Unlock(ctx context.Context, in *Pin, opts ...grpc.CallOption) (*Void, error) {
+	out := new(Void)
+	err := c.cc.Invoke(ctx, "/stashproto.Stash/Unlock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *stashClient) Upload(ctx context.Context, opts ...grpc.CallOption) (Stash_UploadClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Stash_serviceDesc.Streams[2], "/stashproto.Stash/Upload", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &stashUploadClient{stream}
+	return x, nil
+}
+
+type Stash_UploadClient interface {
+	Send(*Chunk) error
+	CloseAndRecv() (*Void, error)
+	grpc.ClientStream
+}
+
+type stashUploadClient struct {
+	grpc.ClientStream
+}
+
+func (x *stashUploadClient) Send(m *Chunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *stashUploadClient) CloseAndRecv() (*Void, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(Void)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // StashServer is the server API for Stash service.
 type StashServer interface {
-	Get(context.Context, *Void) (*Payload, error)
+	Delete(context.Context, *Entry) (*Void, error)
+	Download(*Entry, Stash_DownloadServer) error
+	Get(context.Context, *Entry) (*Payload, error)
+	Hold(*Payload, Stash_HoldServer) error
+	List(context.Context, *Void) (*EntryList, error)
+	Lock(context.Context, *Pin) (*Void, error)
+	Mount(context.Context, *Mount) (*Void, error)
 	Set(context.Context, *Payload) (*Void, error)
+	SetPin(context.Context, *Pin) (*Void, error)
+	Status(context.Context, *Entry) (*Status, error)
+	Unlock(context.Context, *Pin) (*Void, error)
+	Upload(Stash_UploadServer) error
 }
 
 func RegisterStashServer(s *grpc.Server, srv StashServer) {
 	s.RegisterService(&_Stash_serviceDesc, srv)
 }
 
+func _Stash_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Entry)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StashServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/stashproto.Stash/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StashServer).Delete(ctx, req.(*Entry))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Stash_Download_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Entry)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(StashServer).Download(m, &stashDownloadServer{stream})
+}
+
+type Stash_DownloadServer interface {
+	Send(*Chunk) error
+	grpc.ServerStream
+}
+
+type stashDownloadServer struct {
+	grpc.ServerStream
+}
+
+func (x *stashDownloadServer) Send(m *Chunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _Stash_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Void)
+	in := new(Entry)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
@@ -177,7 +830,82 @@ func _Stash_Get_Handler(srv interface{}, ctx context.Context, dec func(interface
 		FullMethod: "/stashproto.Stash/Get",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(StashServer).Get(ctx, req.(*Void))
+		return srv.(StashServer).Get(ctx, req.(*Entry))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Stash_Hold_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Payload)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(StashServer).Hold(m, &stashHoldServer{stream})
+}
+
+type Stash_HoldServer interface {
+	Send(*Void) error
+	grpc.ServerStream
+}
+
+type stashHoldServer struct {
+	grpc.ServerStream
+}
+
+func (x *stashHoldServer) Send(m *Void) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Stash_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Void)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StashServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/stashproto.Stash/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StashServer).List(ctx, req.(*Void))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Stash_Lock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Pin)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StashServer).Lock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/stashproto.Stash/Lock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StashServer).Lock(ctx, req.(*Pin))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Stash_Mount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Mount)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StashServer).Mount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/stashproto.Stash/Mount",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StashServer).Mount(ctx, req.(*Mount))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -200,19 +928,143 @@ func _Stash_Set_Handler(srv interface{}, ctx context.Context, dec func(interface
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Stash_SetPin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Pin)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StashServer).SetPin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/stashproto.Stash/SetPin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StashServer).SetPin(ctx, req.(*Pin))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Stash_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Entry)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StashServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/stashproto.Stash/Status",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StashServer).Status(ctx, req.(*Entry))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Stash_Unlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Pin)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StashServer).Unlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/stashproto.Stash/Unlock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StashServer).Unlock(ctx, req.(*Pin))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Stash_Upload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(StashServer).Upload(&stashUploadServer{stream})
+}
+
+type Stash_UploadServer interface {
+	SendAndClose(*Void) error
+	Recv() (*Chunk, error)
+	grpc.ServerStream
+}
+
+type stashUploadServer struct {
+	grpc.ServerStream
+}
+
+func (x *stashUploadServer) SendAndClose(m *Void) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *stashUploadServer) Recv() (*Chunk, error) {
+	m := new(Chunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _Stash_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "stashproto.Stash",
 	HandlerType: (*StashServer)(nil),
 	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Delete",
+			Handler:    _Stash_Delete_Handler,
+		},
 		{
 			MethodName: "Get",
 			Handler:    _Stash_Get_Handler,
 		},
+		{
+			MethodName: "List",
+			Handler:    _Stash_List_Handler,
+		},
+		{
+			MethodName: "Lock",
+			Handler:    _Stash_Lock_Handler,
+		},
+		{
+			MethodName: "Mount",
+			Handler:    _Stash_Mount_Handler,
+		},
 		{
 			MethodName: "Set",
 			Handler:    _Stash_Set_Handler,
 		},
+		{
+			MethodName: "SetPin",
+			Handler:    _Stash_SetPin_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _Stash_Status_Handler,
+		},
+		{
+			MethodName: "Unlock",
+			Handler:    _Stash_Unlock_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Download",
+			Handler:       _Stash_Download_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Hold",
+			Handler:       _Stash_Hold_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Upload",
+			Handler:       _Stash_Upload_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "stash.proto",
 }
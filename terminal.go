@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// ANSI escape sequences used when printing secrets to a terminal.
+const (
+	ansiSilver      = "\x1b[37;47m"
+	ansiReset       = "\x1b[0m"
+	ansiAltScreen   = "\x1b[?1049h"
+	ansiMainScreen  = "\x1b[?1049l"
+	ansiClearScreen = "\x1b[2J\x1b[H"
+)
+
+// obscure prints s silver on silver when stdout is a terminal so that it
+// can't be read over the user's shoulder but can still be copied.
+func obscure(s string) {
+	if !isatty.IsTerminal(os.Stdout.Fd()) {
+		fmt.Println(s)
+		return
+	}
+	fmt.Printf("%s%s%s\n", ansiSilver, s, ansiReset)
+}
+
+// reveal shows s on the terminal's alternate screen until a key is pressed or
+// timeout elapses. The alternate screen has no scrollback so nothing is left
+// behind once it's cleared.
+func reveal(s string, timeout time.Duration) error {
+	if !isatty.IsTerminal(os.Stdout.Fd()) {
+		return fmt.Errorf("reveal requires a terminal")
+	}
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return fmt.Errorf("unable to open terminal: %v", err)
+	}
+	defer tty.Close()
+	return revealOn(tty, os.Stdout, s, timeout)
+}
+
+// revealOn does the work of reveal, reading the key press from tty and
+// writing to out.
+func revealOn(tty *os.File, out io.Writer, s string, timeout time.Duration) error {
+	state, err := terminal.MakeRaw(int(tty.Fd()))
+	if err != nil {
+		return fmt.Errorf("unable to configure terminal: %v", err)
+	}
+	defer terminal.Restore(int(tty.Fd()), state)
+	fmt.Fprint(out, ansiAltScreen+ansiClearScreen)
+	defer fmt.Fprint(out, ansiClearScreen+ansiMainScreen)
+	fmt.Fprintf(out, "%s\r\n\r\nPress any key to clear", s)
+	if timeout > 0 {
+		fmt.Fprintf(out, " (clearing in %s)", timeout)
+	}
+	pressed := make(chan struct{})
+	go func() {
+		tty.Read(make([]byte, 1))
+		close(pressed)
+	}()
+	var expired <-chan time.Time
+	if timeout > 0 {
+		expired = time.After(timeout)
+	}
+	select {
+	case <-pressed:
+	case <-expired:
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// openPty returns the master and slave ends of a new pseudo-terminal.
+func openPty(t *testing.T) (*os.File, *os.File) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("unable to open a pseudo-terminal: %v\n", err)
+	}
+	var unlock int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		master.Close()
+		t.Skipf("unable to unlock the pseudo-terminal: %v\n", errno)
+	}
+	var n uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); errno != 0 {
+		master.Close()
+		t.Skipf("unable to find the pseudo-terminal: %v\n", errno)
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR, 0)
+	if err != nil {
+		master.Close()
+		t.Skipf("unable to open the pseudo-terminal: %v\n", err)
+	}
+	return master, slave
+}
+
+func TestReveal(t *testing.T) {
+	master, slave := openPty(t)
+	defer master.Close()
+	defer slave.Close()
+	var out bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- revealOn(slave, &out, "secret", 0)
+	}()
+	// Without a timeout reveal waits for a key press
+	select {
+	case err := <-done:
+		t.Fatalf("reveal returned before a key was pressed: %v\n", err)
+	case <-time.After(time.Millisecond * 100):
+	}
+	master.Write([]byte("x"))
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v\n", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("reveal didn't return after a key was pressed\n")
+	}
+	got := out.String()
+	if !strings.HasPrefix(got, ansiAltScreen+ansiClearScreen+"secret") {
+		t.Fatalf("expected the secret on a cleared alternate screen, got: %q\n", got)
+	}
+	// Nothing may be left behind on the main screen
+	if !strings.HasSuffix(got, ansiClearScreen+ansiMainScreen) {
+		t.Fatalf("expected the alternate screen to be cleared, got: %q\n", got)
+	}
+}
+
+func TestRevealTimeout(t *testing.T) {
+	master, slave := openPty(t)
+	defer master.Close()
+	defer slave.Close()
+	var out bytes.Buffer
+	if err := revealOn(slave, &out, "secret", time.Millisecond*50); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	got := out.String()
+	if !strings.Contains(got, "(clearing in 50ms)") || !strings.HasSuffix(got, ansiClearScreen+ansiMainScreen) {
+		t.Fatalf("expected the secret to be cleared after the timeout, got: %q\n", got)
+	}
+}
+
+func TestRevealNotTerminal(t *testing.T) {
+	file, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatalf("unable to open %s: %v\n", os.DevNull, err)
+	}
+	defer file.Close()
+	if err := revealOn(file, &bytes.Buffer{}, "secret", 0); err == nil {
+		t.Fatalf("expected an error when not on a terminal but got none")
+	}
+}